@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"time"
+)
+
+// An AuditSink records reads of values protected by a [Container], see
+// [WithAuditSink].
+type AuditSink interface {
+	// Record is called for every read, with the lock key guarding
+	// the container, the key the value is stored under, whether the
+	// value was returned, and the time of the read.
+	Record(lockKey, valueKey any, granted bool, at time.Time)
+}
+
+type auditSinkKey struct{}
+
+// audit is the context value stored by [WithAuditSink].
+type audit struct {
+	sink AuditSink
+	ts   timestamp
+}
+
+// WithAuditSink returns a copy of parent where every read of a value
+// held by a [Container] is recorded to sink, whether it's read with
+// [Value], [ValueOrReason], [Container.Value] or another function or
+// method reading containers.
+//
+// The time of each read is read from the time source, which can be
+// overridden with the [TimeSource] option, or with [WithClock] or
+// [WithTimeSource] on parent. Reads of keys which are missing or don't
+// hold a container are not recorded.
+func WithAuditSink(parent context.Context, sink AuditSink, opts ...TimestampOption) context.Context {
+	return context.WithValue(parent, auditSinkKey{}, audit{
+		sink: sink,
+		ts:   newTimestamp(parent, time.Time{}, opts),
+	})
+}
+
+// recordAccess records a read of the container stored under valueKey
+// to the audit sink in ctx, if there is one.
+func recordAccess(ctx context.Context, c Container, valueKey any, granted bool) {
+	a, ok := ctx.Value(auditSinkKey{}).(audit)
+	if !ok {
+		return
+	}
+	a.sink.Record(c.key, valueKey, granted, a.ts.now(ctx))
+}
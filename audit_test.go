@@ -0,0 +1,74 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+type auditEvent struct {
+	LockKey  any
+	ValueKey any
+	Granted  bool
+	At       time.Time
+}
+
+type fakeSink struct {
+	events []auditEvent
+}
+
+func (s *fakeSink) Record(lockKey, valueKey any, granted bool, at time.Time) {
+	s.events = append(s.events, auditEvent{lockKey, valueKey, granted, at})
+}
+
+func TestWithAuditSink(t *testing.T) {
+	type lock struct{}
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	sink := &fakeSink{}
+	ctx := contextlock.WithAuditSink(context.Background(), sink, contextlock.TimeSource(nowFn))
+	ctx = contextlock.WithValue(ctx, lock{}, "secret", "value")
+	ctx = context.WithValue(ctx, "plain", "value")
+
+	contextlock.Value(ctx, "secret")
+	contextlock.Value(contextlock.Unlock(ctx, lock{}), "secret")
+	contextlock.Value(ctx, "plain")
+	contextlock.Value(ctx, "missing")
+
+	Equal(t, []auditEvent{
+		{lock{}, "secret", false, t0},
+		{lock{}, "secret", true, t0},
+	}, sink.events)
+}
+
+func TestWithAuditSinkMethods(t *testing.T) {
+	type lock struct{}
+	type other struct{}
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	sink := &fakeSink{}
+	ctx := contextlock.WithAuditSink(context.Background(), sink, contextlock.TimeSource(nowFn))
+	ctx = contextlock.WithValue(ctx, lock{}, "secret", "value")
+	ctx = contextlock.WithTypedValue(ctx, lock{}, "typed", 42)
+	ctx = contextlock.Unlock(ctx, lock{})
+
+	ctx.Value("secret").(contextlock.Container).Value(ctx)
+	ctx.Value("secret").(contextlock.Container).Describe(ctx)
+	ctx.Value("typed").(contextlock.TypedContainer[int]).Value(contextlock.Lock(ctx, lock{}))
+	contextlock.Bind(lock{}).Value(ctx, "secret")
+	contextlock.Bind(other{}).Value(ctx, "secret")
+
+	Equal(t, []auditEvent{
+		{lock{}, "secret", true, t0},
+		{lock{}, "secret", true, t0},
+		{lock{}, "typed", false, t0},
+		{lock{}, "secret", true, t0},
+		{lock{}, "secret", false, t0},
+	}, sink.events)
+}
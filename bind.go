@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+// A LockKey is a lock key bound with [Bind], for code which uses the
+// same lock key throughout.
+type LockKey struct {
+	key any
+}
+
+// Bind returns a [LockKey] whose methods call the package functions of
+// the same name with lockKey.
+func Bind(lockKey any) LockKey {
+	return LockKey{key: lockKey}
+}
+
+// Key returns the bound lock key.
+func (l LockKey) Key() any {
+	return l.key
+}
+
+// Unlock is the same as calling [Unlock] with the bound lock key.
+func (l LockKey) Unlock(parent context.Context) context.Context {
+	return Unlock(parent, l.key)
+}
+
+// Lock is the same as calling [Lock] with the bound lock key.
+func (l LockKey) Lock(parent context.Context) context.Context {
+	return Lock(parent, l.key)
+}
+
+// Unlocked is the same as calling [Unlocked] with the bound lock key.
+func (l LockKey) Unlocked(ctx context.Context) bool {
+	return Unlocked(ctx, l.key)
+}
+
+// WithValue is the same as calling [WithValue] with the bound lock key.
+func (l LockKey) WithValue(parent context.Context, key, value any) context.Context {
+	return WithValue(parent, l.key, key, value)
+}
+
+// Value works like [Value], except that it only returns a value if it's
+// stored in a [Container] guarded by the bound lock key.
+//
+// A value guarded by another lock returns (nil, false) even if that
+// lock is unlocked.
+func (l LockKey) Value(ctx context.Context, key any) (any, bool) {
+	value := ctx.Value(key)
+	container, ok := asContainer(value)
+	if !ok {
+		return value, false
+	}
+
+	if container.key != lock(l.key) {
+		recordAccess(ctx, container, key, false)
+		return nil, false
+	}
+	return container.Value(ctx)
+}
@@ -0,0 +1,45 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestBind(t *testing.T) {
+	type lock struct{}
+	type otherLock struct{}
+	const key = "key"
+	const value = "value"
+
+	l := contextlock.Bind(lock{})
+	Equal(t, any(lock{}), l.Key())
+
+	ctx := l.WithValue(context.Background(), key, value)
+	Equal(t, contextlock.Unlocked(ctx, lock{}), l.Unlocked(ctx))
+
+	v, ok := l.Value(ctx, key)
+	expectedV, expectedOK := contextlock.Value(ctx, key)
+	Equal(t, expectedV, v)
+	Equal(t, expectedOK, ok)
+	False(t, ok)
+
+	unlocked := l.Unlock(ctx)
+	True(t, l.Unlocked(unlocked))
+	True(t, contextlock.Unlocked(unlocked, lock{}))
+
+	v, ok = l.Value(unlocked, key)
+	True(t, ok)
+	Equal(t, value, v)
+
+	locked := l.Lock(unlocked)
+	False(t, l.Unlocked(locked))
+	False(t, contextlock.Unlocked(locked, lock{}))
+
+	// values guarded by other locks aren't returned.
+	ctx = contextlock.WithUnlockedValue(context.Background(), otherLock{}, key, value)
+	v, ok = l.Value(ctx, key)
+	False(t, ok)
+	Nil(t, v)
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Clock provides the current time for time-based locks, see
+// [WithClock].
+type Clock interface {
+	Now() time.Time
+}
+
+type clockKey struct{}
+
+// WithClock returns a copy of parent where time-based locks, such as
+// [TimeLock], read the current time from c.
+//
+// The clock applies to the time-based locks and deadlines added to the
+// returned context and the contexts derived from it, which keep using
+// c when they're evaluated. Locks added before the clock was set keep
+// their own time source, since a clock on the evaluated context would
+// let any code holding the context open every time-based lock. A lock
+// created with the [TimeSource] option uses its time source instead of
+// c.
+func WithClock(parent context.Context, c Clock) context.Context {
+	return context.WithValue(parent, clockKey{}, c)
+}
+
+// WithTimeSource returns a copy of parent where time-based locks read
+// the current time from fn, like [WithClock] with a [Clock] whose Now
+// method calls fn.
+//
+// The current time for a time-based lock is resolved in this order:
+// the time passed to [UnlockedAt], the [TimeSource] option of the lock,
+// the clock or time source set with WithClock or WithTimeSource on the
+// context the lock was added to, whichever was set last, and finally
+// [time.Now]. A time source set on a context derived after the lock
+// was added doesn't apply to it. A nil fn leaves parent unchanged.
+func WithTimeSource(parent context.Context, fn func() time.Time) context.Context {
+	if fn == nil {
+		return parent
+	}
+	return WithClock(parent, clockFunc(fn))
+}
+
+// clockFunc adapts a function to the [Clock] interface.
+type clockFunc func() time.Time
+
+func (fn clockFunc) Now() time.Time {
+	return fn()
+}
+
+// A SimClock is a [Clock] which only changes when told to, for
+// deterministic simulations and tests of time-based locks.
+//
+// The zero value is a clock stopped at the zero time. A SimClock is
+// safe for concurrent use.
+type SimClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the current time of the clock.
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d, or backward if d is negative.
+func (c *SimClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set sets the current time of the clock to t.
+func (c *SimClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
@@ -0,0 +1,101 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestSimClock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+
+	type first struct{}
+	type second struct{}
+	type explicit struct{}
+
+	clock := &contextlock.SimClock{}
+	clock.Set(t0)
+
+	ctx := contextlock.WithClock(context.Background(), clock)
+	ctx = contextlock.TimeLock(ctx, first{}, t0.Add(time.Minute))
+	ctx = contextlock.TimeLock(ctx, second{}, t0.Add(time.Hour))
+	ctx = contextlock.TimeLock(ctx, explicit{}, t0, contextlock.TimeSource(func() time.Time {
+		return t0.Add(-time.Hour)
+	}))
+
+	state := func() []bool {
+		return []bool{
+			contextlock.Unlocked(ctx, first{}),
+			contextlock.Unlocked(ctx, second{}),
+			contextlock.Unlocked(ctx, explicit{}),
+		}
+	}
+
+	Equal(t, []bool{false, false, false}, state())
+
+	clock.Advance(time.Minute)
+	Equal(t, []bool{false, false, false}, state())
+
+	clock.Advance(time.Nanosecond)
+	Equal(t, []bool{true, false, false}, state())
+
+	clock.Advance(time.Hour)
+	Equal(t, []bool{true, true, false}, state())
+
+	clock.Set(t0)
+	Equal(t, []bool{false, false, false}, state())
+}
+
+func TestWithTimeSource(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type timeLock struct{}
+	type windowLock struct{}
+	type explicit struct{}
+
+	ctx := contextlock.WithTimeSource(context.Background(), nowFn)
+	Equal(t, ctx, contextlock.WithTimeSource(ctx, nil))
+	ctx = contextlock.TimeLock(ctx, timeLock{}, t0)
+	ctx = contextlock.TimeWindowLock(ctx, windowLock{}, t0, t0.Add(time.Hour))
+	ctx = contextlock.TimeLock(ctx, explicit{}, t0, contextlock.TimeSource(func() time.Time {
+		return t0.Add(-time.Hour)
+	}))
+
+	False(t, contextlock.Unlocked(ctx, timeLock{}))
+	True(t, contextlock.Unlocked(ctx, windowLock{}))
+
+	tNow = t0.Add(time.Hour)
+	True(t, contextlock.Unlocked(ctx, timeLock{}))
+	False(t, contextlock.Unlocked(ctx, windowLock{}))
+
+	// the explicit option wins.
+	False(t, contextlock.Unlocked(ctx, explicit{}))
+}
+
+func TestWithClockDerived(t *testing.T) {
+	type lock struct{}
+	type deadlined struct{}
+
+	t0 := time.Now()
+	later := func() time.Time { return t0.Add(48 * time.Hour) }
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, "embargoed", "value")
+	ctx = contextlock.TimeLock(ctx, lock{}, t0.Add(24*time.Hour))
+	ctx = contextlock.Unlock(ctx, deadlined{})
+	ctx = contextlock.WithGlobalUnlockDeadline(ctx, t0.Add(-time.Hour))
+
+	// a clock set on a derived context doesn't move the time of locks
+	// and deadlines added before it.
+	for _, derived := range []context.Context{
+		contextlock.WithTimeSource(ctx, later),
+		contextlock.WithClock(ctx, &contextlock.SimClock{}),
+	} {
+		_, ok := contextlock.Value(derived, "embargoed")
+		False(t, ok)
+		False(t, contextlock.Unlocked(derived, deadlined{}))
+	}
+}
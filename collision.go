@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+type collisionCheckKey struct{}
+
+// WithKeyCollisionCheck returns a copy of parent where fn is called
+// with the key whenever a lock or a [Container] is about to replace a
+// different kind of value stored under an equal key.
+//
+// Lock keys and value keys share the key space of the context, so a
+// lock key which is equal to a key passed to [WithValue] replaces the
+// container, and vice versa. Changing a lock with [Lock] or [Unlock],
+// or replacing a container with another container, is not a collision.
+// Values stored under the key by other packages are collisions too,
+// with the exception of booleans, which can't be told apart from locks.
+//
+// This is meant as a debugging aid for finding mistakes in how keys
+// are defined.
+func WithKeyCollisionCheck(parent context.Context, fn func(key any)) context.Context {
+	return context.WithValue(parent, collisionCheckKey{}, fn)
+}
+
+// checkCollision calls the collision check hook in parent, if there is
+// one, if storing a container (or a lock when container is false)
+// under key would replace a value of another kind.
+func checkCollision(parent context.Context, key any, container bool) {
+	fn, ok := parent.Value(collisionCheckKey{}).(func(key any))
+	if !ok {
+		return
+	}
+
+	existing := parent.Value(key)
+	if existing == nil {
+		return
+	}
+
+	_, isContainer := asContainer(existing)
+	isLock := kindOf(existing) != KindNone
+	if (container && !isContainer) || (!container && !isLock) {
+		fn(key)
+	}
+}
@@ -0,0 +1,33 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestWithKeyCollisionCheck(t *testing.T) {
+	var collisions []any
+	ctx := contextlock.WithKeyCollisionCheck(context.Background(), func(key any) {
+		collisions = append(collisions, key)
+	})
+
+	// changing a lock or a container isn't a collision.
+	ctx = contextlock.Unlock(ctx, "admin")
+	ctx = contextlock.Lock(ctx, "admin")
+	ctx = contextlock.WithValue(ctx, "admin", "credentials", "hunter2")
+	ctx = contextlock.WithValue(ctx, "admin", "credentials", "hunter3")
+	Equal(t, []any(nil), collisions)
+
+	// a lock key equal to a value key replaces the container, and the
+	// other way around.
+	ctx = contextlock.Unlock(ctx, "credentials")
+	ctx = contextlock.WithValue(ctx, "admin", "admin", "hunter2")
+	Equal(t, []any{"credentials", "admin"}, collisions)
+
+	// values set by others are collisions.
+	ctx = context.WithValue(ctx, "user", 42)
+	contextlock.Unlock(ctx, "user")
+	Equal(t, []any{"credentials", "admin", "user"}, collisions)
+}
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sort"
+)
+
+// exclusive is the lock value stored by [ExclusiveLock].
+type exclusive []any
+
+// all is the lock value stored by [AndLock].
+type all []any
+
+// anyOf is the lock value stored by [OrLock].
+type anyOf []any
+
+// not is the lock value stored by [NotLock].
+type not struct {
+	Key any
+}
+
+// namedQuorum is the lock value stored by [NamedQuorumLock], with the
+// members sorted by name.
+type namedQuorum struct {
+	Threshold int
+	Names     []string
+	Keys      []any
+}
+
+// ExclusiveLock returns a copy of parent where the lock is unlocked only
+// when none of the locks behind others are unlocked in the evaluated
+// context.
+//
+// This can be used for a fallback which is only available while no
+// primary path is active. The other locks are evaluated as nested
+// locks, see [WithMaxDepth], and if evaluating them trips the maximum
+// depth or a cycle, the lock is locked rather than treating them as
+// locked. If others is empty, the lock is unlocked.
+func ExclusiveLock(parent context.Context, lockKey any, others ...any) context.Context {
+	return withLock(parent, lockKey, exclusive(append([]any(nil), others...)))
+}
+
+func (e exclusive) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, other := range e {
+		if Unlocked(nested, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// AndLock returns a copy of parent where the lock is unlocked only when
+// every lock behind keys is unlocked in the evaluated context.
+//
+// The locks are evaluated in order as nested locks, see [WithMaxDepth],
+// and evaluation stops at the first locked lock, so expensive locks
+// such as a [FunctionLock] are best placed last. If keys is empty, the
+// lock is locked.
+func AndLock(parent context.Context, lockKey any, keys ...any) context.Context {
+	return withLock(parent, lockKey, all(append([]any(nil), keys...)))
+}
+
+func (a all) unlocked(ctx context.Context) bool {
+	if len(a) == 0 {
+		return false
+	}
+
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, k := range a {
+		if !Unlocked(nested, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrLock returns a copy of parent where the lock is unlocked when at
+// least one of the locks behind keys is unlocked in the evaluated
+// context.
+//
+// The locks are evaluated in order as nested locks, see [WithMaxDepth],
+// and evaluation stops at the first unlocked lock. If keys is empty,
+// the lock is locked.
+func OrLock(parent context.Context, lockKey any, keys ...any) context.Context {
+	return withLock(parent, lockKey, anyOf(append([]any(nil), keys...)))
+}
+
+func (a anyOf) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, k := range a {
+		if Unlocked(nested, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// NamedQuorumLock returns a copy of parent where the lock is unlocked
+// when at least threshold of the locks in members are unlocked in the
+// evaluated context.
+//
+// The members map a name, such as the role of an approver, to a lock
+// key. Every member is evaluated as a nested lock in the order of their
+// names, so the [Trace] of the lock lists every member with its name
+// and whether it was unlocked. The lock is locked if threshold is less
+// than 1.
+func NamedQuorumLock(parent context.Context, lockKey any, threshold int, members map[string]any) context.Context {
+	q := namedQuorum{Threshold: threshold}
+	for name := range members {
+		q.Names = append(q.Names, name)
+	}
+	sort.Strings(q.Names)
+	for _, name := range q.Names {
+		q.Keys = append(q.Keys, members[name])
+	}
+
+	return withLock(parent, lockKey, q)
+}
+
+func (q namedQuorum) unlocked(ctx context.Context) bool {
+	if q.Threshold < 1 {
+		return false
+	}
+
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	var unlocked int
+	for i, k := range q.Keys {
+		if Unlocked(withTraceName(nested, q.Names[i]), k) {
+			unlocked++
+		}
+	}
+	return unlocked >= q.Threshold
+}
+
+// NotLock returns a copy of parent where the lock is unlocked exactly
+// when the lock behind invertKey is locked in the evaluated context.
+//
+// The inverted lock is evaluated as a nested lock, see [WithMaxDepth].
+// If evaluating the inverted lock trips the maximum depth or a cycle,
+// the NotLock is locked rather than unlocked. A NotLock for a lock key
+// without any lock is unlocked, since such locks are always locked.
+func NotLock(parent context.Context, lockKey any, invertKey any) context.Context {
+	return withLock(parent, lockKey, not{Key: invertKey})
+}
+
+func (n not) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+	return !Unlocked(nested, n.Key)
+}
+
+type groupsKey struct{}
+
+// LockGroup returns a copy of parent where the locks behind memberKeys
+// are members of the group with the lock behind groupKey.
+//
+// A member is unlocked when its own lock is unlocked or when the lock
+// of any of its groups is unlocked, see [UnlockGroup]. This means that
+// locking a member with [Lock] doesn't lock it while its group is
+// unlocked, the group has to be locked as well. The group lock is
+// evaluated as a nested lock, see [WithMaxDepth], and can be any type
+// of lock. A lock can be a member of several groups, and groups are
+// added to the ones already set on parent.
+func LockGroup(parent context.Context, groupKey any, memberKeys ...any) context.Context {
+	existing, _ := parent.Value(groupsKey{}).(map[any][]any)
+	groups := make(map[any][]any, len(existing)+len(memberKeys))
+	for k, g := range existing {
+		groups[k] = g
+	}
+	for _, member := range memberKeys {
+		g := groups[member]
+		groups[member] = append(g[:len(g):len(g)], groupKey)
+	}
+	return context.WithValue(parent, groupsKey{}, groups)
+}
+
+// UnlockGroup returns a copy of parent where the lock behind groupKey is
+// unlocked, which unlocks every member of the group, see [LockGroup].
+func UnlockGroup(parent context.Context, groupKey any) context.Context {
+	return Unlock(parent, groupKey)
+}
+
+// lockGroups returns the keys of the groups that lockKey is a member of
+// in ctx.
+func lockGroups(ctx context.Context, lockKey any) []any {
+	groups, _ := ctx.Value(groupsKey{}).(map[any][]any)
+	return groups[lockKey]
+}
+
+// groupUnlocked returns true if any of the groups that lockKey is a
+// member of is unlocked in ctx.
+func groupUnlocked(ctx context.Context, lockKey any) bool {
+	groups := lockGroups(ctx, lockKey)
+	if len(groups) == 0 {
+		return false
+	}
+
+	ctx, e, ok := enter(ctx, lockKey)
+	if !ok {
+		return false
+	}
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, g := range groups {
+		if Unlocked(nested, g) {
+			return !e.tripped.Load()
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestExclusiveLock(t *testing.T) {
+	type fallback struct{}
+	type primary struct{}
+	type secondary struct{}
+	type tertiary struct{}
+
+	tests := []struct {
+		name     string
+		unlock   []any
+		others   []any
+		unlocked bool
+	}{
+		{"no others", nil, nil, true},
+		{"none unlocked", nil, []any{primary{}, secondary{}, tertiary{}}, true},
+		{"one unlocked", []any{secondary{}}, []any{primary{}, secondary{}, tertiary{}}, false},
+		{"several unlocked", []any{primary{}, tertiary{}}, []any{primary{}, secondary{}, tertiary{}}, false},
+		{"unrelated unlocked", []any{tertiary{}}, []any{primary{}, secondary{}}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contextlock.ExclusiveLock(context.Background(), fallback{}, tc.others...)
+			for _, k := range tc.unlock {
+				ctx = contextlock.Unlock(ctx, k)
+			}
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, fallback{}))
+		})
+	}
+}
+
+func TestExclusiveLockLimits(t *testing.T) {
+	type fallback struct{}
+	type primary struct{}
+	type open struct{}
+
+	ctx := contextlock.Unlock(context.Background(), open{})
+	ctx = contextlock.AndLock(ctx, primary{}, open{})
+	ctx = contextlock.ExclusiveLock(ctx, fallback{}, primary{})
+	False(t, contextlock.Unlocked(ctx, fallback{}))
+
+	// the primary path can't be evaluated, which doesn't mean that it's
+	// inactive.
+	limited := contextlock.WithMaxDepth(ctx, 1)
+	False(t, contextlock.Unlocked(limited, fallback{}))
+	unlocked, reason := contextlock.LockStatus(limited, fallback{})
+	False(t, unlocked)
+	Equal(t, "nested evaluation exceeded the maximum depth or found a cycle", reason)
+
+	cyclic := contextlock.ExclusiveLock(context.Background(), fallback{}, fallback{})
+	False(t, contextlock.Unlocked(cyclic, fallback{}))
+}
+
+func TestAndLock(t *testing.T) {
+	type lock struct{}
+	type window struct{}
+	type role struct{}
+	type nested struct{}
+
+	var calls int
+	expensive := func(ctx context.Context) bool {
+		calls++
+		return true
+	}
+
+	ctx := contextlock.FunctionLock(context.Background(), role{}, expensive)
+	ctx = contextlock.AndLock(ctx, lock{}, window{}, role{})
+
+	// the function lock isn't evaluated when the first lock is locked.
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, 0, calls)
+
+	ctx = contextlock.Unlock(ctx, window{})
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, 1, calls)
+
+	t.Run("nested", func(t *testing.T) {
+		ctx := contextlock.AndLock(ctx, nested{}, lock{}, window{})
+		True(t, contextlock.Unlocked(ctx, nested{}))
+		False(t, contextlock.Unlocked(contextlock.Lock(ctx, role{}), nested{}))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		ctx := contextlock.AndLock(context.Background(), lock{})
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestOrLock(t *testing.T) {
+	type lock struct{}
+	type admin struct{}
+	type owner struct{}
+	type other struct{}
+
+	var calls []string
+	ctx := contextlock.FunctionLock(context.Background(), admin{}, func(ctx context.Context) bool {
+		calls = append(calls, "admin")
+		return false
+	})
+	ctx = contextlock.FunctionLock(ctx, owner{}, func(ctx context.Context) bool {
+		calls = append(calls, "owner")
+		return true
+	})
+	ctx = contextlock.FunctionLock(ctx, other{}, func(ctx context.Context) bool {
+		calls = append(calls, "other")
+		return true
+	})
+	ctx = contextlock.OrLock(ctx, lock{}, admin{}, owner{}, other{})
+
+	// evaluation stops at the first unlocked lock.
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, []string{"admin", "owner"}, calls)
+
+	t.Run("none unlocked", func(t *testing.T) {
+		ctx := contextlock.OrLock(ctx, lock{}, admin{}, "unknown")
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		ctx := contextlock.OrLock(context.Background(), lock{})
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestNamedQuorumLock(t *testing.T) {
+	type lock struct{}
+	type alice struct{}
+	type bob struct{}
+	type carol struct{}
+
+	members := map[string]any{
+		"security": alice{},
+		"legal":    bob{},
+		"manager":  carol{},
+	}
+
+	ctx := contextlock.NamedQuorumLock(context.Background(), lock{}, 2, members)
+	ctx = contextlock.Unlock(ctx, alice{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	ctx = contextlock.AndLock(ctx, carol{}, alice{})
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	Equal(t, []contextlock.TraceEntry{
+		{Key: lock{}, Kind: contextlock.KindComposite, Depth: 0, Unlocked: true},
+		{Key: bob{}, Name: "legal", Kind: contextlock.KindNone, Depth: 1, Unlocked: false},
+		{Key: carol{}, Name: "manager", Kind: contextlock.KindComposite, Depth: 1, Unlocked: true},
+		{Key: alice{}, Kind: contextlock.KindBool, Depth: 2, Unlocked: true},
+		{Key: alice{}, Name: "security", Kind: contextlock.KindBool, Depth: 1, Unlocked: true},
+	}, contextlock.Trace(ctx, lock{}))
+
+	t.Run("threshold below 1", func(t *testing.T) {
+		ctx := contextlock.NamedQuorumLock(context.Background(), lock{}, 0, members)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestNotLock(t *testing.T) {
+	type lock struct{}
+	type businessHours struct{}
+
+	ctx := contextlock.NotLock(context.Background(), lock{}, businessHours{})
+
+	True(t, contextlock.Unlocked(contextlock.Lock(ctx, businessHours{}), lock{}))
+	False(t, contextlock.Unlocked(contextlock.Unlock(ctx, businessHours{}), lock{}))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+func TestNotLockLimits(t *testing.T) {
+	type lock struct{}
+	type inner struct{}
+	type open struct{}
+
+	// a NotLock inverting itself trips the cycle limit.
+	ctx := contextlock.NotLock(context.Background(), lock{}, lock{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	// a NotLock inverting a lock beyond the depth limit.
+	ctx = contextlock.Unlock(context.Background(), open{})
+	ctx = contextlock.AndLock(ctx, inner{}, open{})
+	ctx = contextlock.NotLock(ctx, lock{}, inner{})
+	ctx = contextlock.WithValue(ctx, lock{}, "secret", "value")
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	limited := contextlock.WithMaxDepth(ctx, 1)
+	False(t, contextlock.Unlocked(limited, lock{}))
+	_, ok := contextlock.Value(limited, "secret")
+	False(t, ok)
+}
+
+func TestLockGroup(t *testing.T) {
+	const group = "admin"
+	const reader = "reader"
+	const writer = "writer"
+
+	ctx := contextlock.LockGroup(context.Background(), group, reader, writer)
+	ctx = contextlock.Unlock(ctx, reader)
+	True(t, contextlock.Unlocked(ctx, reader))
+	False(t, contextlock.Unlocked(ctx, writer))
+
+	ctx = contextlock.UnlockGroup(ctx, group)
+	True(t, contextlock.Unlocked(ctx, reader))
+	True(t, contextlock.Unlocked(ctx, writer))
+	False(t, contextlock.Unlocked(ctx, "other"))
+
+	// a locked member is unlocked by its group.
+	locked := contextlock.Lock(ctx, writer)
+	True(t, contextlock.Unlocked(locked, writer))
+	unlocked, reason := contextlock.LockStatus(locked, writer)
+	True(t, unlocked)
+	Equal(t, "group admin is unlocked", reason)
+
+	locked = contextlock.Lock(locked, group)
+	False(t, contextlock.Unlocked(locked, writer))
+}
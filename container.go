@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"reflect"
+)
+
+// reader is implemented by values stored in a [Container] which need
+// to be transformed before they're returned from an unlocked
+// container. It can only be implemented within the contextlock package.
+type reader interface {
+	read(ctx context.Context) (any, bool)
+}
+
+// encrypted is a value sealed with an AEAD by [WithEncryptedValue].
+type encrypted struct {
+	aead       cipher.AEAD
+	nonce      []byte
+	ciphertext []byte
+}
+
+// pipeline is a value with transforms applied on read by
+// [WithValuePipeline].
+type pipeline struct {
+	value      any
+	transforms []func(any) any
+}
+
+// versioned is a value with a version stored by [WithVersionedValue].
+type versioned struct {
+	key     any
+	value   any
+	version int64
+}
+
+// expectedVersionKey is the context key for the expected version of
+// the value stored under key, set by [WithExpectedVersion].
+type expectedVersionKey struct {
+	key any
+}
+
+// correlated is a value bound to a trace by [WithCorrelatedValue].
+type correlated struct {
+	value    any
+	traceKey any
+	expected any
+}
+
+// tiered is a value with a limited variant for locked containers, see
+// [WithTieredValue].
+type tiered struct {
+	full    any
+	limited any
+}
+
+// WithEncryptedValue returns a copy of parent in which the key is
+// associated with a [Container] holding value encrypted with aead.
+//
+// The plaintext is only kept in memory until the value has been sealed
+// with a random nonce, and [Value] decrypts and returns the plaintext
+// as a []byte only when lockKey is unlocked. A locked container never
+// attempts to decrypt the value. If decryption fails, the container
+// behaves as if it were locked.
+//
+// WithEncryptedValue panics if a random nonce cannot be generated.
+func WithEncryptedValue(parent context.Context, lockKey, key any, value []byte, aead cipher.AEAD) context.Context {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("contextlock: failed to generate nonce: " + err.Error())
+	}
+
+	return WithValue(parent, lockKey, key, encrypted{
+		aead:       aead,
+		nonce:      nonce,
+		ciphertext: aead.Seal(nil, nonce, value, nil),
+	})
+}
+
+func (e encrypted) read(context.Context) (any, bool) {
+	plaintext, err := e.aead.Open(nil, e.nonce, e.ciphertext, nil)
+	if err != nil {
+		return nil, false
+	}
+	return plaintext, true
+}
+
+// WithValuePipeline returns a copy of parent in which the key is
+// associated with a [Container] holding value, where transforms are
+// applied to the value when it's read from the unlocked container.
+//
+// The transforms are applied in order on every read, with each
+// transform receiving the result of the previous one, and are never
+// called while the container is locked. This can be used to redact or
+// reshape protected data at the point it's read.
+func WithValuePipeline(parent context.Context, lockKey, key, value any, transforms ...func(any) any) context.Context {
+	return WithValue(parent, lockKey, key, pipeline{
+		value:      value,
+		transforms: append([]func(any) any(nil), transforms...),
+	})
+}
+
+func (p pipeline) read(context.Context) (any, bool) {
+	value := p.value
+	for _, transform := range p.transforms {
+		value = transform(value)
+	}
+	return value, true
+}
+
+// WithVersionedValue returns a copy of parent in which the key is
+// associated with a [Container] holding value at version.
+//
+// The value is only returned when the container is unlocked and the
+// context passed to [Value] expects the same version of the value
+// under key, as set by [WithExpectedVersion]. This can be used for
+// optimistic concurrency at the read layer, where a value is only read
+// if it hasn't changed since the reader last saw it.
+func WithVersionedValue(parent context.Context, lockKey, key, value any, version int64) context.Context {
+	return WithValue(parent, lockKey, key, versioned{
+		key:     key,
+		value:   value,
+		version: version,
+	})
+}
+
+// WithExpectedVersion returns a copy of parent which expects the value
+// stored under key by [WithVersionedValue] to be at version.
+//
+// The expected version is specific to key, so different keys can
+// expect different versions in the same context.
+func WithExpectedVersion(parent context.Context, key any, version int64) context.Context {
+	return context.WithValue(parent, expectedVersionKey{key: key}, version)
+}
+
+func (v versioned) read(ctx context.Context) (any, bool) {
+	expected, ok := ctx.Value(expectedVersionKey{key: v.key}).(int64)
+	if !ok || expected != v.version {
+		return nil, false
+	}
+	return v.value, true
+}
+
+// WithCorrelatedValue returns a copy of parent in which the key is
+// associated with a [Container] holding value, which is only returned
+// within the trace or session identified by expected.
+//
+// The value is returned when the container is unlocked and the value
+// stored under traceKey in the context passed to [Value] is deeply
+// equal to expected, according to [reflect.DeepEqual].
+func WithCorrelatedValue(parent context.Context, lockKey, key, value any, traceKey any, expected any) context.Context {
+	return WithValue(parent, lockKey, key, correlated{
+		value:    value,
+		traceKey: traceKey,
+		expected: expected,
+	})
+}
+
+func (c correlated) read(ctx context.Context) (any, bool) {
+	if !reflect.DeepEqual(ctx.Value(c.traceKey), c.expected) {
+		return nil, false
+	}
+	return c.value, true
+}
+
+// Flatten returns a copy of ctx where the value of each of keys which
+// is held by an unlocked [Container] is stored directly under the key,
+// for passing the context to code which reads values with
+// [context.Context.Value] and doesn't know about containers.
+//
+// Keys which are locked, missing or don't hold a container are left as
+// they are. The locks are evaluated once, when Flatten is called, and
+// the flattened values are no longer protected: they stay readable in
+// the returned context and every context derived from it even if the
+// locks are locked later, and they can be read by any code with access
+// to the key. Only flatten the keys the receiving code needs.
+func Flatten(ctx context.Context, keys ...any) context.Context {
+	flat := ctx
+	for _, key := range keys {
+		value, ok := Value(ctx, key)
+		if !ok {
+			continue
+		}
+		flat = context.WithValue(flat, key, value)
+	}
+	return flat
+}
+
+// Relock returns a copy of parent where the [Container] or
+// [TypedContainer] stored under key is guarded by newLockKey instead of
+// oldLockKey, without having to read the value and add it again.
+//
+// The old lock key no longer unlocks the value in the returned context
+// and the contexts derived from it. Since relocking a container gives
+// access to its value to whoever holds newLockKey, the caller must
+// prove that it knows the current lock key: if key doesn't hold a
+// container guarded by oldLockKey, parent is returned unchanged.
+func Relock(parent context.Context, key any, oldLockKey, newLockKey any) context.Context {
+	c, ok := parent.Value(key).(protected)
+	if !ok || c.container().key != lock(oldLockKey) {
+		return parent
+	}
+	return context.WithValue(parent, key, c.relock(newLockKey))
+}
+
+// WithTieredValue returns a copy of parent in which the key is
+// associated with a [Container] which holds full while lockKey is
+// unlocked and limited while it's locked, for degrading gracefully
+// rather than withholding the value.
+//
+// Unlike other containers, a locked tiered container still returns
+// true from [Value] and [Container.Value], since the limited value is
+// always available. Use [Unlocked] to tell the two apart. Reads of the
+// limited value are recorded as denied by an [AuditSink].
+func WithTieredValue(parent context.Context, lockKey, key, full, limited any) context.Context {
+	return WithValue(parent, lockKey, key, tiered{
+		full:    full,
+		limited: limited,
+	})
+}
+
+func (t tiered) read(ctx context.Context) (any, bool) {
+	return t.full, true
+}
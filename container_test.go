@@ -0,0 +1,214 @@
+package contextlock_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+// recordingAEAD counts the calls to Open on the wrapped AEAD.
+type recordingAEAD struct {
+	cipher.AEAD
+	opened int
+}
+
+func (r *recordingAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	r.opened++
+	return r.AEAD.Open(dst, nonce, ciphertext, additionalData)
+}
+
+func TestWithEncryptedValue(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+	secret := []byte("correct horse battery staple")
+
+	block, err := aes.NewCipher(bytes.Repeat([]byte{0x42}, 32))
+	Nil(t, err)
+	gcm, err := cipher.NewGCM(block)
+	Nil(t, err)
+	aead := &recordingAEAD{AEAD: gcm}
+
+	ctx := contextlock.WithEncryptedValue(context.Background(), lock{}, key, secret, aead)
+
+	v, ok := contextlock.Value(ctx, key)
+	False(t, ok)
+	Nil(t, v)
+	Equal(t, 0, aead.opened)
+
+	v, ok = contextlock.Value(contextlock.Unlock(ctx, lock{}), key)
+	True(t, ok)
+	Equal(t, secret, v.([]byte))
+	Equal(t, 1, aead.opened)
+}
+
+func TestWithValuePipeline(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	var calls []string
+	redact := func(v any) any {
+		calls = append(calls, "redact")
+		return strings.Replace(v.(string), "hunter2", "*******", 1)
+	}
+	upper := func(v any) any {
+		calls = append(calls, "upper")
+		return strings.ToUpper(v.(string))
+	}
+
+	ctx := contextlock.WithValuePipeline(context.Background(), lock{}, key, "password: hunter2", redact, upper)
+
+	v, ok := contextlock.Value(ctx, key)
+	False(t, ok)
+	Nil(t, v)
+	Equal(t, []string(nil), calls)
+
+	v, ok = contextlock.Value(contextlock.Unlock(ctx, lock{}), key)
+	True(t, ok)
+	Equal(t, any("PASSWORD: *******"), v)
+	Equal(t, []string{"redact", "upper"}, calls)
+}
+
+func TestWithVersionedValue(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+	const value = "value"
+
+	ctx := contextlock.WithVersionedValue(context.Background(), lock{}, key, value, 3)
+	ctx = contextlock.Unlock(ctx, lock{})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		ok   bool
+	}{
+		{"matching", contextlock.WithExpectedVersion(ctx, key, 3), true},
+		{"mismatching", contextlock.WithExpectedVersion(ctx, key, 2), false},
+		{"other key", contextlock.WithExpectedVersion(ctx, "other", 3), false},
+		{"no expected version", ctx, false},
+		{"locked", contextlock.Lock(contextlock.WithExpectedVersion(ctx, key, 3), lock{}), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := contextlock.Value(tc.ctx, key)
+			Equal(t, tc.ok, ok)
+			if tc.ok {
+				Equal(t, any(value), v)
+			} else {
+				Nil(t, v)
+			}
+		})
+	}
+}
+
+func TestWithCorrelatedValue(t *testing.T) {
+	type lock struct{}
+	type traceID struct{}
+	const key = "key"
+	const value = "value"
+
+	ctx := contextlock.WithCorrelatedValue(context.Background(), lock{}, key, value, traceID{}, "trace-1")
+	ctx = contextlock.Unlock(ctx, lock{})
+
+	v, ok := contextlock.Value(context.WithValue(ctx, traceID{}, "trace-1"), key)
+	True(t, ok)
+	Equal(t, any(value), v)
+
+	v, ok = contextlock.Value(context.WithValue(ctx, traceID{}, "trace-2"), key)
+	False(t, ok)
+	Nil(t, v)
+
+	v, ok = contextlock.Value(ctx, key)
+	False(t, ok)
+	Nil(t, v)
+}
+
+func TestFlatten(t *testing.T) {
+	type reader struct{}
+	type admin struct{}
+	type name struct{}
+	type secret struct{}
+	type plain struct{}
+
+	ctx := contextlock.WithValue(context.Background(), reader{}, name{}, "Emil")
+	ctx = contextlock.WithValue(ctx, admin{}, secret{}, "hunter2")
+	ctx = context.WithValue(ctx, plain{}, "plain")
+	ctx = contextlock.Unlock(ctx, reader{})
+
+	flat := contextlock.Flatten(ctx, name{}, secret{}, plain{}, "missing")
+	Equal(t, any("Emil"), flat.Value(name{}))
+	Equal(t, any("plain"), flat.Value(plain{}))
+	Nil(t, flat.Value("missing"))
+
+	_, isContainer := flat.Value(secret{}).(contextlock.Container)
+	True(t, isContainer)
+
+	// the flattened value stays readable when the lock is locked.
+	flat = contextlock.Lock(flat, reader{})
+	Equal(t, any("Emil"), flat.Value(name{}))
+}
+
+func TestRelock(t *testing.T) {
+	type oldLock struct{}
+	type newLock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), oldLock{}, key, "value")
+	ctx = contextlock.Unlock(ctx, oldLock{})
+
+	relocked := contextlock.Relock(ctx, key, oldLock{}, newLock{})
+	_, ok := contextlock.Value(relocked, key)
+	False(t, ok)
+
+	v, ok := contextlock.Value(contextlock.Unlock(relocked, newLock{}), key)
+	True(t, ok)
+	Equal(t, any("value"), v)
+
+	// the parent is unchanged.
+	_, ok = contextlock.Value(ctx, key)
+	True(t, ok)
+
+	plain := context.WithValue(ctx, "plain", "value")
+	Equal(t, plain, contextlock.Relock(plain, "plain", oldLock{}, newLock{}))
+	Equal(t, plain, contextlock.Relock(plain, "missing", oldLock{}, newLock{}))
+}
+
+func TestRelockWrongLockKey(t *testing.T) {
+	type secret struct{}
+	type mine struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), secret{}, key, "value")
+
+	// a container can't be taken over without knowing its lock key.
+	relocked := contextlock.Relock(ctx, key, mine{}, mine{})
+	Equal(t, ctx, relocked)
+	_, ok := contextlock.Value(contextlock.Unlock(relocked, mine{}), key)
+	False(t, ok)
+}
+
+func TestWithTieredValue(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithTieredValue(context.Background(), lock{}, key, "4111 1111 1111 1111", "**** 1111")
+
+	v, ok := contextlock.Value(ctx, key)
+	True(t, ok)
+	Equal(t, any("**** 1111"), v)
+
+	v, code, ok := contextlock.ValueOrReason(ctx, key)
+	True(t, ok)
+	Equal(t, "", code)
+	Equal(t, any("**** 1111"), v)
+
+	ctx = contextlock.Unlock(ctx, lock{})
+	v, ok = contextlock.Value(ctx, key)
+	True(t, ok)
+	Equal(t, any("4111 1111 1111 1111"), v)
+}
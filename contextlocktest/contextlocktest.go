@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: MIT-0
+
+// Package contextlocktest provides utilities for testing code which
+// uses the contextlock package.
+package contextlocktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+// offsets are the offsets from the boundary checked by
+// [AssertUnlocksAt], the lock is expected to be locked for offsets
+// which aren't positive.
+var offsets = []time.Duration{
+	-time.Hour,
+	-time.Second,
+	-time.Nanosecond,
+	0,
+	time.Nanosecond,
+	time.Second,
+	time.Hour,
+}
+
+// AssertUnlocksAt asserts that the lock behind key transitions from
+// locked to unlocked exactly at boundary, in the same way as a
+// [contextlock.TimeLock] does.
+//
+// The newContext function is called once for every instant checked,
+// with a function returning that instant, and should return a context
+// where the lock is created using it as the time source, for example by
+// passing it to [contextlock.TimeSource]. The lock must be locked at
+// and before boundary, and unlocked at every instant after boundary.
+func AssertUnlocksAt(t testing.TB, newContext func(now func() time.Time) context.Context, key any, boundary time.Time) {
+	t.Helper()
+
+	for _, offset := range offsets {
+		at := boundary.Add(offset)
+		ctx := newContext(func() time.Time { return at })
+
+		expected := offset > 0
+		if unlocked := contextlock.Unlocked(ctx, key); unlocked != expected {
+			t.Errorf("contextlocktest: at %s (%v from boundary): expected unlocked to be %v, got %v", at.Format(time.RFC3339Nano), offset, expected, unlocked)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package contextlocktest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+	"github.com/sakjur/contextlock/contextlocktest"
+)
+
+// recorder is a testing.TB which records errors instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertUnlocksAt(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+
+	type lock struct{}
+
+	timeLock := func(at time.Time) func(now func() time.Time) context.Context {
+		return func(now func() time.Time) context.Context {
+			return contextlock.TimeLock(context.Background(), lock{}, at, contextlock.TimeSource(now))
+		}
+	}
+
+	contextlocktest.AssertUnlocksAt(t, timeLock(t0), lock{}, t0)
+
+	r := &recorder{TB: t}
+	contextlocktest.AssertUnlocksAt(r, timeLock(t0.Add(time.Second)), lock{}, t0)
+	if len(r.errors) != 2 {
+		t.Fatalf("expected 2 errors for a lock unlocking a second late, got %d: %v", len(r.errors), r.errors)
+	}
+}
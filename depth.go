@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// DefaultMaxDepth is the limit for nested lock evaluation used for
+// contexts where no limit has been set with [WithMaxDepth].
+const DefaultMaxDepth = 100
+
+type maxDepthKey struct{}
+
+type depthKey struct{}
+
+type evaluationKey struct{}
+
+type pathKey struct{}
+
+type limitHookKey struct{}
+
+// evaluation is the state of an evaluation of a lock which evaluates
+// other locks, shared by the nested evaluations.
+type evaluation struct {
+	// key is the lock key of the outermost lock.
+	key any
+	// tripped is set once a limit described in [WithMaxDepth] has
+	// been tripped anywhere in the evaluation.
+	tripped atomic.Bool
+}
+
+// pathNode is an entry in the list of lock keys being evaluated below
+// the outermost lock, from the innermost lock outwards.
+type pathNode struct {
+	key  any
+	next *pathNode
+}
+
+// WithMaxDepth returns a copy of parent where nested lock evaluation is
+// limited to depth levels.
+//
+// A lock is nested when it's evaluated as part of evaluating another
+// lock, such as a [FunctionLock] calling [Unlocked] for another lock
+// key. Evaluating a lock beyond the limit makes [Unlocked] report it as
+// locked, which bounds the cost of evaluating deeply nested locks. When
+// no limit is set, [DefaultMaxDepth] is used.
+//
+// Independently of the limit, a lock which is evaluated again while
+// it's already being evaluated, such as a lock combining itself, is
+// reported as locked, so cyclic locks are evaluated at most once per
+// path. When either limit is tripped anywhere below a lock, the lock
+// and every lock evaluated after that as part of the same call to
+// [Unlocked] are locked, so that a lock such as a [NotLock] can't turn
+// the tripped limit into an unlocked lock. See [WithLimitHook] for
+// observing either case.
+func WithMaxDepth(parent context.Context, depth int) context.Context {
+	if depth < 0 {
+		depth = 0
+	}
+	return context.WithValue(parent, maxDepthKey{}, depth)
+}
+
+// WithLimitHook returns a copy of parent where fn is called with the
+// lock key when evaluating a lock trips the limits described in
+// [WithMaxDepth], either because nesting further would exceed the
+// maximum depth or because the lock is already being evaluated.
+//
+// The hook replaces any hook set on parent. A nil fn removes it.
+func WithLimitHook(parent context.Context, fn func(lockKey any)) context.Context {
+	return context.WithValue(parent, limitHookKey{}, fn)
+}
+
+// descend returns the context in which locks nested under a lock
+// evaluated in ctx should be evaluated. The second return value is
+// false if nesting further would exceed the maximum depth.
+func descend(ctx context.Context) (context.Context, bool) {
+	depth, _ := ctx.Value(depthKey{}).(int)
+	limit, ok := ctx.Value(maxDepthKey{}).(int)
+	if !ok {
+		limit = DefaultMaxDepth
+	}
+
+	if depth >= limit {
+		limitTripped(ctx, currentKey(ctx))
+		return ctx, false
+	}
+	return context.WithValue(ctx, depthKey{}, depth+1), true
+}
+
+// nests returns true if evaluating the lock value val may evaluate
+// other locks. Only such locks can be part of a cycle, so the path of
+// lock keys used to detect cycles is only built for them, and
+// evaluating other locks, such as a lock set with [Unlock], doesn't
+// allocate.
+func nests(val any) bool {
+	switch val.(type) {
+	case exclusive, all, anyOf, namedQuorum, not, custom, gate,
+		errLockFunction, cachedFunction, lockFunction:
+		return true
+	default:
+		return false
+	}
+}
+
+// enter returns the context in which the lock behind lockKey should
+// evaluate other locks, and the evaluation it's part of. The third
+// return value is false if the lock is already being evaluated in ctx.
+func enter(ctx context.Context, lockKey any) (context.Context, *evaluation, bool) {
+	e, ok := ctx.Value(evaluationKey{}).(*evaluation)
+	if !ok {
+		e = &evaluation{key: lockKey}
+		return context.WithValue(ctx, evaluationKey{}, e), e, true
+	}
+
+	head, _ := ctx.Value(pathKey{}).(*pathNode)
+	for n := head; n != nil; n = n.next {
+		if n.key == lockKey {
+			limitTripped(ctx, lockKey)
+			return ctx, e, false
+		}
+	}
+	if e.key == lockKey {
+		limitTripped(ctx, lockKey)
+		return ctx, e, false
+	}
+	return context.WithValue(ctx, pathKey{}, &pathNode{key: lockKey, next: head}), e, true
+}
+
+// currentKey returns the lock key of the innermost lock being
+// evaluated in ctx, or nil if no lock is being evaluated.
+func currentKey(ctx context.Context) any {
+	if head, ok := ctx.Value(pathKey{}).(*pathNode); ok {
+		return head.key
+	}
+	if e, ok := ctx.Value(evaluationKey{}).(*evaluation); ok {
+		return e.key
+	}
+	return nil
+}
+
+// tripped returns true if a limit has been tripped in the evaluation
+// ctx is part of, see [WithMaxDepth].
+func tripped(ctx context.Context) bool {
+	e, ok := ctx.Value(evaluationKey{}).(*evaluation)
+	return ok && e.tripped.Load()
+}
+
+// limitTripped marks the evaluation in ctx as tripped and calls the
+// hook registered with [WithLimitHook], if any.
+func limitTripped(ctx context.Context, lockKey any) {
+	if e, ok := ctx.Value(evaluationKey{}).(*evaluation); ok {
+		e.tripped.Store(true)
+	}
+	if fn, ok := ctx.Value(limitHookKey{}).(func(lockKey any)); ok && fn != nil {
+		fn(lockKey)
+	}
+}
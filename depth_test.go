@@ -0,0 +1,103 @@
+package contextlock_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+// chain returns a context where lock 0 depends on lock 1 and so on
+// through to the final lock n, which is unlocked.
+func chain(parent context.Context, n int) context.Context {
+	ctx := contextlock.Unlock(parent, n)
+	for i := 0; i < n; i++ {
+		next := i + 1
+		ctx = contextlock.FunctionLock(ctx, i, func(ctx context.Context) bool {
+			return contextlock.Unlocked(ctx, next)
+		})
+	}
+	return ctx
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	tests := []struct {
+		depth    int
+		unlocked bool
+	}{
+		{0, false},
+		{9, false},
+		{10, true},
+		{contextlock.DefaultMaxDepth, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("depth %d = %v", tc.depth, tc.unlocked), func(t *testing.T) {
+			ctx := chain(contextlock.WithMaxDepth(context.Background(), tc.depth), 10)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, 0))
+		})
+	}
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	ctx := chain(context.Background(), contextlock.DefaultMaxDepth)
+	True(t, contextlock.Unlocked(ctx, 0))
+
+	ctx = chain(context.Background(), contextlock.DefaultMaxDepth+1)
+	False(t, contextlock.Unlocked(ctx, 0))
+}
+
+func TestCyclicLock(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		return !contextlock.Unlocked(ctx, lock{})
+	})
+
+	// the evaluation terminates rather than recursing forever, and the
+	// cycle is reported as locked even though the lock negates itself.
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+func TestBranchingCyclicLock(t *testing.T) {
+	type lock struct{}
+
+	var tripped []any
+	ctx := contextlock.WithLimitHook(context.Background(), func(lockKey any) {
+		tripped = append(tripped, lockKey)
+	})
+	ctx = contextlock.OrLock(ctx, lock{}, lock{}, lock{}, lock{})
+
+	// every nested evaluation of the lock is cut short rather than
+	// branching out to the depth limit.
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, []any{lock{}, lock{}, lock{}}, tripped)
+}
+
+func TestWithLimitHookDepth(t *testing.T) {
+	var tripped []any
+	ctx := contextlock.WithLimitHook(context.Background(), func(lockKey any) {
+		tripped = append(tripped, lockKey)
+	})
+	ctx = chain(contextlock.WithMaxDepth(ctx, 3), 10)
+
+	False(t, contextlock.Unlocked(ctx, 0))
+	Equal(t, []any{3}, tripped)
+}
+
+func TestUnlockedPlainLockAllocs(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.Unlock(context.Background(), lock{})
+	for i := 0; i < 40; i++ {
+		ctx = context.WithValue(ctx, i, i)
+	}
+
+	// cycle detection doesn't cost anything for locks which don't
+	// evaluate other locks.
+	allocs := testing.AllocsPerRun(100, func() {
+		contextlock.Unlocked(ctx, lock{})
+	})
+	Equal(t, float64(0), allocs)
+}
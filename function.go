@@ -0,0 +1,344 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// errLockFunction is the lock value stored by [ErrFunctionLock].
+type errLockFunction func(ctx context.Context) (bool, error)
+
+type lockErrKey struct{}
+
+// lockErr holds the first error returned while evaluating a lock with
+// [UnlockedErr].
+type lockErr struct {
+	mu  sync.Mutex
+	err error
+}
+
+// cachedFunction is the lock value stored by [CachedFunctionLock].
+type cachedFunction struct {
+	fn   lockFunction
+	cell *cachedResult
+}
+
+// cachedResult is the result of a [CachedFunctionLock], shared by every
+// context the lock is in.
+type cachedResult struct {
+	mu       sync.Mutex
+	state    cacheState
+	unlocked bool
+	// generation is incremented by [InvalidateCache], so that a result
+	// computed before the invalidation isn't cached.
+	generation int
+}
+
+// cacheState is the state of a [cachedResult].
+type cacheState int
+
+const (
+	// cacheEmpty means that the function hasn't been called yet, or
+	// that its result couldn't be cached.
+	cacheEmpty cacheState = iota
+	// cacheRunning means that the function is being called.
+	cacheRunning
+	// cacheDone means that the result has been cached.
+	cacheDone
+)
+
+// A Decorator wraps the function of a [FunctionLock] to add behavior
+// around it, in the style of HTTP middleware. See [Decorate].
+type Decorator func(next func(ctx context.Context) bool) func(ctx context.Context) bool
+
+// Decorate returns a copy of parent where the function of the
+// [FunctionLock] behind lockKey is wrapped by decorators.
+//
+// The first decorator is the outermost, so it's called first and sees
+// the result last. If lockKey doesn't hold a function lock in parent,
+// parent is returned unchanged.
+func Decorate(parent context.Context, lockKey any, decorators ...Decorator) context.Context {
+	fn, ok := parent.Value(lock(lockKey)).(lockFunction)
+	if !ok {
+		return parent
+	}
+
+	next := func(ctx context.Context) bool { return fn(ctx) }
+	for i := len(decorators) - 1; i >= 0; i-- {
+		next = decorators[i](next)
+	}
+	return FunctionLock(parent, lockKey, next)
+}
+
+// WithTiming returns a [Decorator] which calls report with how long
+// each call to the decorated function took.
+func WithTiming(report func(d time.Duration)) Decorator {
+	return func(next func(ctx context.Context) bool) func(ctx context.Context) bool {
+		return func(ctx context.Context) bool {
+			start := time.Now()
+			defer func() { report(time.Since(start)) }()
+			return next(ctx)
+		}
+	}
+}
+
+// WithRecovery returns a [Decorator] which recovers from panics in the
+// decorated function and treats them as the lock being locked.
+//
+// Function locks recover from panics by default, so this is only needed
+// for recovering in contexts created with [WithStrictUnlockers], or for
+// recovering before the result reaches the outer decorators.
+func WithRecovery() Decorator {
+	return func(next func(ctx context.Context) bool) func(ctx context.Context) bool {
+		return func(ctx context.Context) (unlocked bool) {
+			defer func() {
+				if recover() != nil {
+					unlocked = false
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// WithLogging returns a [Decorator] which logs the result of each call
+// to the decorated function using logf, such as [log.Printf].
+func WithLogging(logf func(format string, v ...any)) Decorator {
+	return func(next func(ctx context.Context) bool) func(ctx context.Context) bool {
+		return func(ctx context.Context) bool {
+			unlocked := next(ctx)
+			logf("contextlock: function lock returned %v", unlocked)
+			return unlocked
+		}
+	}
+}
+
+// FunctionLockTimeout works like [FunctionLock], but treats the lock
+// as locked if fn doesn't return within timeout.
+//
+// The fn function is called in a separate goroutine with a context
+// derived from the evaluated context which is canceled when the
+// timeout expires, so fn should return as soon as possible when the
+// context is done. If fn ignores the context, the goroutine keeps
+// running after [Unlocked] has returned and is leaked until fn returns.
+//
+// A panic in fn is handled like a panic in the function of a
+// [FunctionLock], see [WithPanicObserver] and [WithStrictUnlockers].
+// If fn panics after the timeout, the panic can't propagate to the
+// caller of [Unlocked] anymore and is only passed to the observer.
+func FunctionLockTimeout(parent context.Context, lockKey any, fn func(ctx context.Context) bool, timeout time.Duration) context.Context {
+	type outcome struct {
+		unlocked  bool
+		recovered any
+	}
+
+	return FunctionLock(parent, lockKey, func(ctx context.Context) bool {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result := make(chan outcome, 1)
+		go func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if ctx.Err() != nil {
+					observePanic(ctx, v)
+					return
+				}
+				result <- outcome{recovered: v}
+			}()
+			result <- outcome{unlocked: fn(ctx)}
+		}()
+
+		select {
+		case o := <-result:
+			if o.recovered != nil {
+				// raised again in the evaluating goroutine, where the
+				// function lock recovers it unless strict.
+				panic(o.recovered)
+			}
+			return o.unlocked
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// ErrFunctionLock works like [FunctionLock], but fn can return an error
+// to distinguish a failing check, such as a database error, from the
+// lock being locked.
+//
+// The lock is unlocked when fn returns true and a nil error. [Unlocked]
+// and [Value] treat an error as the lock being locked, use
+// [UnlockedErr] and [ValueErr] to also get the error.
+func ErrFunctionLock(parent context.Context, lockKey any, fn func(ctx context.Context) (bool, error)) context.Context {
+	return withLock(parent, lockKey, errLockFunction(fn))
+}
+
+// UnlockedErr works like [Unlocked], but if the lock is locked it also
+// returns the first error returned by an [ErrFunctionLock] during the
+// evaluation, including from nested locks such as the locks of an
+// [AndLock]. The error is nil when the lock is unlocked.
+func UnlockedErr(ctx context.Context, lockKey any) (bool, error) {
+	slot := &lockErr{}
+	if Unlocked(context.WithValue(ctx, lockErrKey{}, slot), lockKey) {
+		return true, nil
+	}
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	return false, slot.err
+}
+
+// ValueErr works like [Value], but if the value is stored in a locked
+// container it also returns the error from evaluating the lock, see
+// [UnlockedErr].
+func ValueErr(ctx context.Context, key any) (any, bool, error) {
+	value := ctx.Value(key)
+	container, ok := asContainer(value)
+	if !ok {
+		return value, false, nil
+	}
+
+	unlocked, err := UnlockedErr(ctx, container.key)
+	if !unlocked {
+		recordAccess(ctx, container, key, false)
+		if value, ok := container.locked(); ok {
+			return value, true, err
+		}
+		return nil, false, err
+	}
+
+	value, ok = container.unwrap(ctx)
+	recordAccess(ctx, container, key, ok)
+	return value, ok, nil
+}
+
+func (fn lockFunction) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	if !strictUnlockers(ctx) {
+		defer recoverLock(ctx)
+	}
+	countEval(ctx)
+	return fn(nested)
+}
+
+func (fn errLockFunction) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	if !strictUnlockers(ctx) {
+		defer recoverLock(ctx)
+	}
+
+	countEval(ctx)
+	unlocked, err := fn(nested)
+	if err != nil {
+		if slot, ok := ctx.Value(lockErrKey{}).(*lockErr); ok {
+			slot.mu.Lock()
+			if slot.err == nil {
+				slot.err = err
+			}
+			slot.mu.Unlock()
+		}
+		return false
+	}
+	return unlocked
+}
+
+// CachedFunctionLock works like [FunctionLock], but fn is only called
+// the first time the lock is evaluated and the result is reused for
+// every evaluation after that.
+//
+// This is meant for functions which are expensive to call, such as a
+// policy check over the network. The result is shared by every context
+// derived from the returned context. Since fn is only called once, the
+// context passed to it is derived from the context of the first
+// evaluation. A panic in fn is treated as locked and cached like other
+// results. Use [InvalidateCache] to have fn called again.
+//
+// While fn is being called, the lock is locked for every other
+// evaluation rather than waiting for fn to return, since fn may depend
+// on the lock itself, directly or through other cached function locks
+// evaluated concurrently, which would never finish. If evaluating fn
+// trips a limit described in [WithMaxDepth], the result isn't cached
+// and fn is called again on the next evaluation.
+func CachedFunctionLock(parent context.Context, lockKey any, fn func(ctx context.Context) bool) context.Context {
+	return withLock(parent, lockKey, cachedFunction{
+		fn:   fn,
+		cell: &cachedResult{},
+	})
+}
+
+// InvalidateCache marks the cached result of the [CachedFunctionLock]
+// behind lockKey in parent as stale, so that the next evaluation of the
+// lock calls its function again.
+//
+// The result is shared by every context the lock is in, so the
+// invalidation applies to parent and every context derived from the
+// context the lock was added to, and parent is returned unchanged. If
+// the function is being called while the cache is invalidated, its
+// result is returned to that evaluation but not cached. If lockKey
+// doesn't have a cached function lock in parent, InvalidateCache does
+// nothing.
+func InvalidateCache(parent context.Context, lockKey any) context.Context {
+	c, ok := parent.Value(lock(lockKey)).(cachedFunction)
+	if !ok {
+		return parent
+	}
+
+	c.cell.mu.Lock()
+	defer c.cell.mu.Unlock()
+	c.cell.generation++
+	if c.cell.state == cacheDone {
+		c.cell.state = cacheEmpty
+	}
+	return parent
+}
+
+func (c cachedFunction) unlocked(ctx context.Context) bool {
+	c.cell.mu.Lock()
+	switch c.cell.state {
+	case cacheDone:
+		defer c.cell.mu.Unlock()
+		return c.cell.unlocked
+	case cacheRunning:
+		c.cell.mu.Unlock()
+		return false
+	}
+	c.cell.state = cacheRunning
+	generation := c.cell.generation
+	c.cell.mu.Unlock()
+
+	// the state is reset if fn panics with strict unlockers.
+	state := cacheEmpty
+	var unlocked bool
+	defer func() {
+		c.cell.mu.Lock()
+		defer c.cell.mu.Unlock()
+		if c.cell.generation != generation {
+			state = cacheEmpty
+		}
+		c.cell.state = state
+		c.cell.unlocked = unlocked
+	}()
+
+	unlocked = c.fn.unlocked(ctx)
+	if tripped(ctx) {
+		unlocked = false
+	} else {
+		state = cacheDone
+	}
+	return unlocked
+}
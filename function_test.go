@@ -0,0 +1,353 @@
+package contextlock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestDecorate(t *testing.T) {
+	type lock struct{}
+
+	var calls []string
+	record := func(name string) contextlock.Decorator {
+		return func(next func(ctx context.Context) bool) func(ctx context.Context) bool {
+			return func(ctx context.Context) bool {
+				calls = append(calls, name+" before")
+				unlocked := next(ctx)
+				calls = append(calls, name+" after")
+				return unlocked
+			}
+		}
+	}
+
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		calls = append(calls, "fn")
+		return true
+	})
+	ctx = contextlock.Decorate(ctx, lock{}, record("a"), record("b"))
+
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, []string{"a before", "b before", "fn", "b after", "a after"}, calls)
+}
+
+func TestDecorateNotFunctionLock(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.Unlock(context.Background(), lock{})
+	Equal(t, ctx, contextlock.Decorate(ctx, lock{}, contextlock.WithRecovery()))
+}
+
+func TestDecorators(t *testing.T) {
+	type lock struct{}
+
+	var durations []time.Duration
+	var logs []string
+
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		panic("oops")
+	})
+	ctx = contextlock.Decorate(ctx, lock{},
+		contextlock.WithTiming(func(d time.Duration) { durations = append(durations, d) }),
+		contextlock.WithLogging(func(format string, v ...any) { logs = append(logs, fmt.Sprintf(format, v...)) }),
+		contextlock.WithRecovery(),
+	)
+
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, 1, len(durations))
+	Equal(t, []string{"contextlock: function lock returned false"}, logs)
+}
+
+func TestFunctionLockTimeout(t *testing.T) {
+	type lock struct{}
+
+	t.Run("fast", func(t *testing.T) {
+		ctx := contextlock.FunctionLockTimeout(context.Background(), lock{}, func(ctx context.Context) bool {
+			return true
+		}, time.Minute)
+		True(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		done := make(chan struct{})
+		ctx := contextlock.FunctionLockTimeout(context.Background(), lock{}, func(ctx context.Context) bool {
+			<-ctx.Done()
+			close(done)
+			return true
+		}, 10*time.Millisecond)
+
+		False(t, contextlock.Unlocked(ctx, lock{}))
+		<-done
+	})
+
+	t.Run("deadline passed to fn", func(t *testing.T) {
+		ctx := contextlock.FunctionLockTimeout(context.Background(), lock{}, func(ctx context.Context) bool {
+			_, ok := ctx.Deadline()
+			return ok
+		}, time.Minute)
+		True(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var observed []any
+		ctx := contextlock.WithPanicObserver(context.Background(), func(v any) {
+			observed = append(observed, v)
+		})
+		ctx = contextlock.FunctionLockTimeout(ctx, lock{}, func(ctx context.Context) bool {
+			panic("oops")
+		}, time.Minute)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+		Equal(t, []any{"oops"}, observed)
+
+		defer func() {
+			Equal(t, any("oops"), recover())
+		}()
+		contextlock.Unlocked(contextlock.WithStrictUnlockers(ctx), lock{})
+		t.Fatal("expected panic")
+	})
+}
+
+func TestErrFunctionLock(t *testing.T) {
+	type lock struct{}
+	type and struct{}
+	const key = "key"
+	const value = "value"
+
+	errDB := errors.New("database unavailable")
+
+	tests := []struct {
+		name     string
+		fn       func(ctx context.Context) (bool, error)
+		unlocked bool
+		err      error
+	}{
+		{"unlocked", func(ctx context.Context) (bool, error) { return true, nil }, true, nil},
+		{"locked", func(ctx context.Context) (bool, error) { return false, nil }, false, nil},
+		{"error", func(ctx context.Context) (bool, error) { return false, errDB }, false, errDB},
+		{"true with error", func(ctx context.Context) (bool, error) { return true, errDB }, false, errDB},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contextlock.WithValue(context.Background(), lock{}, key, value)
+			ctx = contextlock.ErrFunctionLock(ctx, lock{}, tc.fn)
+
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+
+			unlocked, err := contextlock.UnlockedErr(ctx, lock{})
+			Equal(t, tc.unlocked, unlocked)
+			Equal(t, tc.err, err)
+
+			v, ok, err := contextlock.ValueErr(ctx, key)
+			Equal(t, tc.unlocked, ok)
+			Equal(t, tc.err, err)
+			if tc.unlocked {
+				Equal(t, any(value), v)
+			}
+
+			// errors from nested locks are surfaced as well.
+			ctx = contextlock.AndLock(ctx, and{}, lock{})
+			_, err = contextlock.UnlockedErr(ctx, and{})
+			Equal(t, tc.err, err)
+		})
+	}
+}
+
+func TestFunctionLockPanic(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		panic("oops")
+	})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	var observed []any
+	observedCtx := contextlock.WithPanicObserver(ctx, func(v any) {
+		observed = append(observed, v)
+	})
+	False(t, contextlock.Unlocked(observedCtx, lock{}))
+	Equal(t, []any{"oops"}, observed)
+
+	errCtx := contextlock.ErrFunctionLock(observedCtx, lock{}, func(ctx context.Context) (bool, error) {
+		panic("oops again")
+	})
+	unlocked, err := contextlock.UnlockedErr(errCtx, lock{})
+	False(t, unlocked)
+	Nil(t, err)
+	Equal(t, []any{"oops", "oops again"}, observed)
+
+	defer func() {
+		Equal(t, any("oops"), recover())
+		Equal(t, 2, len(observed))
+	}()
+	contextlock.Unlocked(contextlock.WithStrictUnlockers(observedCtx), lock{})
+	t.Fatal("expected panic")
+}
+
+func TestCachedFunctionLock(t *testing.T) {
+	type lock struct{}
+
+	var calls, evaluations int64
+	ctx := contextlock.CachedFunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		calls++
+		return true
+	})
+	ctx = contextlock.WithEvalCounter(ctx, lock{}, &evaluations)
+	Equal(t, contextlock.KindFunction, contextlock.LockKind(ctx, lock{}))
+
+	for i := 0; i < 5; i++ {
+		True(t, contextlock.Unlocked(context.WithValue(ctx, "request", i), lock{}))
+	}
+	Equal(t, int64(1), calls)
+	Equal(t, int64(1), evaluations)
+
+	// an uncached function lock is evaluated every time.
+	evaluations = 0
+	uncached := contextlock.FunctionLock(ctx, lock{}, func(ctx context.Context) bool {
+		return true
+	})
+	for i := 0; i < 5; i++ {
+		True(t, contextlock.Unlocked(uncached, lock{}))
+	}
+	Equal(t, int64(5), evaluations)
+}
+
+func TestInvalidateCache(t *testing.T) {
+	type lock struct{}
+
+	var calls int
+	unlocked := true
+	ctx := contextlock.CachedFunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		calls++
+		return unlocked
+	})
+	derived := context.WithValue(ctx, "request", 1)
+
+	True(t, contextlock.Unlocked(derived, lock{}))
+	unlocked = false
+	True(t, contextlock.Unlocked(derived, lock{}))
+	Equal(t, 1, calls)
+
+	// the invalidation is shared with contexts derived from the lock.
+	Equal(t, ctx, contextlock.InvalidateCache(ctx, lock{}))
+	False(t, contextlock.Unlocked(derived, lock{}))
+	False(t, contextlock.Unlocked(derived, lock{}))
+	Equal(t, 2, calls)
+
+	// other locks are left alone.
+	plain := contextlock.Unlock(ctx, "other")
+	Equal(t, plain, contextlock.InvalidateCache(plain, "other"))
+	Equal(t, plain, contextlock.InvalidateCache(plain, "missing"))
+}
+
+func TestInvalidateCacheInFlight(t *testing.T) {
+	type lock struct{}
+
+	var calls int
+	var ctx context.Context
+	ctx = contextlock.CachedFunctionLock(context.Background(), lock{}, func(context.Context) bool {
+		calls++
+		if calls == 1 {
+			contextlock.InvalidateCache(ctx, lock{})
+		}
+		return true
+	})
+
+	// a result computed while the cache is invalidated isn't cached.
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, 2, calls)
+}
+
+func TestCachedFunctionLockConcurrent(t *testing.T) {
+	type lock struct{}
+
+	var calls atomic.Int64
+	ctx := contextlock.CachedFunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		calls.Add(1)
+		return false
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			contextlock.Unlocked(ctx, lock{})
+		}()
+	}
+	wg.Wait()
+	Equal(t, int64(1), calls.Load())
+}
+
+func TestCachedFunctionLockCyclic(t *testing.T) {
+	type lock struct{}
+	type other struct{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ctx := contextlock.CachedFunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+			return !contextlock.Unlocked(ctx, lock{})
+		})
+		// the cycle trips the limit, which fails closed.
+		False(t, contextlock.Unlocked(ctx, lock{}))
+		False(t, contextlock.Unlocked(ctx, lock{}))
+
+		ctx = contextlock.CachedFunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+			return !contextlock.Unlocked(ctx, other{})
+		})
+		ctx = contextlock.OrLock(ctx, other{}, lock{})
+		False(t, contextlock.Unlocked(ctx, lock{}))
+		False(t, contextlock.Unlocked(ctx, other{}))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("evaluating a cyclic cached function lock deadlocked")
+	}
+}
+
+func TestCachedFunctionLockConcurrentCyclic(t *testing.T) {
+	type a struct{}
+	type b struct{}
+
+	// both functions start before either evaluates the other lock, so
+	// each sees the other in flight.
+	var started sync.WaitGroup
+	started.Add(2)
+	ctx := contextlock.CachedFunctionLock(context.Background(), a{}, func(ctx context.Context) bool {
+		started.Done()
+		started.Wait()
+		return !contextlock.Unlocked(ctx, b{})
+	})
+	ctx = contextlock.CachedFunctionLock(ctx, b{}, func(ctx context.Context) bool {
+		started.Done()
+		started.Wait()
+		return !contextlock.Unlocked(ctx, a{})
+	})
+
+	results := make(chan bool, 2)
+	go func() { results <- contextlock.Unlocked(ctx, a{}) }()
+	go func() { results <- contextlock.Unlocked(ctx, b{}) }()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-results:
+		case <-time.After(5 * time.Second):
+			t.Fatal("evaluating cached function locks depending on each other deadlocked")
+		}
+	}
+
+	// at least one of the functions saw the other in flight and locked.
+	True(t, contextlock.Unlocked(ctx, a{}) || contextlock.Unlocked(ctx, b{}))
+}
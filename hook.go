@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+type accessHooksKey struct{}
+
+// AddAccessHook returns a copy of parent where fn is called with the
+// lock key and the result every time a lock is evaluated with
+// [Unlocked], including nested evaluations.
+//
+// Hooks are added to the hooks already registered in parent rather
+// than replacing them, and are called in the order they were added.
+// Since the hooks are called for every evaluation, they should be
+// cheap. A nil fn is ignored.
+func AddAccessHook(parent context.Context, fn func(lockKey any, granted bool)) context.Context {
+	if fn == nil {
+		return parent
+	}
+
+	existing := accessHooks(parent)
+	hooks := make([]func(lockKey any, granted bool), 0, len(existing)+1)
+	hooks = append(hooks, existing...)
+	hooks = append(hooks, fn)
+	return context.WithValue(parent, accessHooksKey{}, hooks)
+}
+
+// accessHooks returns the access hooks registered in ctx.
+func accessHooks(ctx context.Context) []func(lockKey any, granted bool) {
+	hooks, _ := ctx.Value(accessHooksKey{}).([]func(lockKey any, granted bool))
+	return hooks
+}
+
+// WithUnlockObserver returns a copy of parent where fn is called with
+// the lock key every time [Unlocked] reports a lock as unlocked,
+// regardless of the type of lock. It isn't called for locked locks.
+//
+// The observer is registered as an access hook, see [AddAccessHook],
+// and is called synchronously on every unlocked check, including
+// nested evaluations and every read with [Value]. Slow observers slow
+// down every read of a protected value, so expensive work such as
+// writing to an audit log should be handed off. A nil fn is ignored.
+func WithUnlockObserver(parent context.Context, fn func(lockKey any)) context.Context {
+	if fn == nil {
+		return parent
+	}
+
+	return AddAccessHook(parent, func(lockKey any, granted bool) {
+		if granted {
+			fn(lockKey)
+		}
+	})
+}
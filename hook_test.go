@@ -0,0 +1,56 @@
+package contextlock_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestAddAccessHook(t *testing.T) {
+	var calls []string
+	hook := func(name string) func(lockKey any, granted bool) {
+		return func(lockKey any, granted bool) {
+			calls = append(calls, fmt.Sprintf("%s: %v %v", name, lockKey, granted))
+		}
+	}
+
+	ctx := contextlock.AddAccessHook(context.Background(), hook("metrics"))
+	ctx = contextlock.AddAccessHook(ctx, nil)
+	withLogging := contextlock.AddAccessHook(ctx, hook("logging"))
+	withLogging = contextlock.Unlock(withLogging, "reader")
+
+	contextlock.Unlocked(withLogging, "reader")
+	contextlock.Unlocked(withLogging, "writer")
+	Equal(t, []string{
+		"metrics: reader true",
+		"logging: reader true",
+		"metrics: writer false",
+		"logging: writer false",
+	}, calls)
+
+	// the parent only has the first hook.
+	calls = nil
+	contextlock.Unlocked(ctx, "reader")
+	Equal(t, []string{"metrics: reader false"}, calls)
+}
+
+func TestWithUnlockObserver(t *testing.T) {
+	var observed []any
+	ctx := contextlock.WithUnlockObserver(context.Background(), func(lockKey any) {
+		observed = append(observed, lockKey)
+	})
+
+	ctx = contextlock.Unlock(ctx, "bool")
+	ctx = contextlock.TimeLock(ctx, "time", time.Now().Add(-time.Hour))
+	ctx = contextlock.FunctionLock(ctx, "function", func(ctx context.Context) bool {
+		return true
+	})
+
+	for _, lockKey := range []any{"bool", "time", "function", "locked"} {
+		contextlock.Unlocked(ctx, lockKey)
+	}
+	Equal(t, []any{"bool", "time", "function"}, observed)
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+// Kind describes what type of lock is stored for a lock key.
+type Kind int
+
+const (
+	// KindNone means that the lock key doesn't hold a lock. Such
+	// locks are always locked.
+	KindNone Kind = iota
+	// KindBool is a lock set with [Lock], [Unlock], [AlwaysLocked] or
+	// [AlwaysUnlocked].
+	KindBool
+	// KindTime is a lock which depends on the current time, such as
+	// [TimeLock] and [GrantLock].
+	KindTime
+	// KindFunction is a lock set with [FunctionLock],
+	// [ErrFunctionLock] or [CachedFunctionLock].
+	KindFunction
+	// KindValue is a lock which depends on a value in the context or
+	// on the context itself, such as [ETagLock] or [HasDeadlineLock].
+	KindValue
+	// KindComposite is a lock which depends on other locks, such as
+	// [AndLock].
+	KindComposite
+	// KindCustom is a lock set with [CustomLock] or a self-gating lock
+	// key, see [WithSelfGatingKeys].
+	KindCustom
+	// KindStateful is a lock whose state changes as it's evaluated,
+	// such as [CountLock].
+	KindStateful
+)
+
+// String returns a lowercase name for the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	case KindFunction:
+		return "function"
+	case KindValue:
+		return "value"
+	case KindComposite:
+		return "composite"
+	case KindCustom:
+		return "custom"
+	case KindStateful:
+		return "stateful"
+	default:
+		return "unknown"
+	}
+}
+
+// LockKind returns the [Kind] of the lock behind lockKey in ctx.
+func LockKind(ctx context.Context, lockKey any) Kind {
+	return kindOf(lockValue(ctx, lockKey))
+}
+
+// kindOf returns the [Kind] for a lock value.
+func kindOf(val any) Kind {
+	switch val := val.(type) {
+	case bool, always:
+		return KindBool
+	case precomputed:
+		return val.Kind
+	case timestamp, window, deadline, freshness, jittered, grant:
+		return KindTime
+	case lockFunction, errLockFunction, cachedFunction:
+		return KindFunction
+	case condition, equals, match, before, sdkFlag, hasDeadline, healthy, trusted:
+		return KindValue
+	case exclusive, all, anyOf, not, namedQuorum:
+		return KindComposite
+	case custom, gate:
+		return KindCustom
+	case counted, firstSeen, rateLimited, scoped, once:
+		return KindStateful
+	default:
+		return KindNone
+	}
+}
+
+// Describe works like [Container.Value] but also returns the [Kind] of
+// the lock guarding the container, whether it's locked or not.
+func (c Container) Describe(ctx context.Context) (value any, ok bool, kind Kind) {
+	value, ok = c.Value(ctx)
+	return value, ok, LockKind(ctx, c.key)
+}
@@ -0,0 +1,75 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestLockKind(t *testing.T) {
+	type lock struct{}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		kind contextlock.Kind
+	}{
+		{"none", context.Background(), contextlock.KindNone},
+		{"unlock", contextlock.Unlock(context.Background(), lock{}), contextlock.KindBool},
+		{"lock", contextlock.Lock(context.Background(), lock{}), contextlock.KindBool},
+		{"time", contextlock.TimeLock(context.Background(), lock{}, time.Now()), contextlock.KindTime},
+		{"function", contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool { return true }), contextlock.KindFunction},
+		{"value", contextlock.ETagLock(context.Background(), lock{}, "etag", "v1"), contextlock.KindValue},
+		{"composite", contextlock.ExclusiveLock(context.Background(), lock{}), contextlock.KindComposite},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			Equal(t, tc.kind, contextlock.LockKind(tc.ctx, lock{}))
+		})
+	}
+}
+
+func TestKindString(t *testing.T) {
+	Equal(t, "none", contextlock.KindNone.String())
+	Equal(t, "bool", contextlock.KindBool.String())
+	Equal(t, "time", contextlock.KindTime.String())
+	Equal(t, "function", contextlock.KindFunction.String())
+	Equal(t, "value", contextlock.KindValue.String())
+	Equal(t, "composite", contextlock.KindComposite.String())
+	Equal(t, "custom", contextlock.KindCustom.String())
+	Equal(t, "stateful", contextlock.KindStateful.String())
+	Equal(t, "unknown", contextlock.Kind(-1).String())
+}
+
+func TestContainerDescribe(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+	const value = "value"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, value)
+	container := ctx.Value(key).(contextlock.Container)
+
+	v, ok, kind := container.Describe(ctx)
+	Nil(t, v)
+	False(t, ok)
+	Equal(t, contextlock.KindNone, kind)
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+	ctx = contextlock.TimeLock(ctx, lock{}, t0, contextlock.TimeSource(nowFn))
+
+	v, ok, kind = container.Describe(ctx)
+	Nil(t, v)
+	False(t, ok)
+	Equal(t, contextlock.KindTime, kind)
+
+	tNow = t0.Add(time.Second)
+	v, ok, kind = container.Describe(ctx)
+	Equal(t, any(value), v)
+	True(t, ok)
+	Equal(t, contextlock.KindTime, kind)
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+type trackedKey struct{}
+
+// tracked is the set of lock keys and value keys added to a context
+// after tracking has been enabled with [TrackLocks] or [WithLockLimit].
+type tracked struct {
+	limit int
+	head  *trackedNode
+}
+
+// trackedNode is an element in the persistent list of tracked keys,
+// which is shared between derived contexts.
+type trackedNode struct {
+	key       any
+	container bool
+	count     int
+	next      *trackedNode
+}
+
+// WithLockLimit returns a copy of parent where the number of distinct
+// locks and containers added to the context and the contexts derived
+// from it is tracked and limited to max, see [LockCount].
+//
+// Once the limit has been reached, adding a lock or a [Container] for
+// another key returns the parent context unchanged, so the lock stays
+// as it was and the value isn't stored. Locks and containers for keys
+// which are already tracked can still be replaced, for example with
+// [Lock] and [Unlock]. So that the limit never keeps a lock unlocked,
+// a lock for a key which already has a lock in parent, such as a key
+// unlocked before tracking was enabled, is always added, but isn't
+// tracked beyond the limit. A lock for a key without a lock can be
+// left out, since such a key is locked already. A max of zero or less
+// tracks the keys without limiting them. Keys added to parent before
+// tracking was enabled aren't counted.
+func WithLockLimit(parent context.Context, max int) context.Context {
+	t, _ := parent.Value(trackedKey{}).(tracked)
+	t.limit = max
+	return context.WithValue(parent, trackedKey{}, t)
+}
+
+// TrackLocks returns a copy of parent where the lock keys and value
+// keys added to the context and the contexts derived from it are
+// tracked, for listing them with [Locks] and counting them with
+// [LockCount].
+//
+// Since a context can't be iterated, keys are only tracked when they're
+// added to a context derived from a tracking context, and keys added to
+// parent before tracking was enabled don't appear. [WithLockLimit] also
+// enables tracking. If parent is already tracked, it's returned
+// unchanged.
+func TrackLocks(parent context.Context) context.Context {
+	if _, ok := parent.Value(trackedKey{}).(tracked); ok {
+		return parent
+	}
+	return context.WithValue(parent, trackedKey{}, tracked{})
+}
+
+// Locks returns the lock keys which have been added to ctx by this
+// package since tracking was enabled with [TrackLocks] or
+// [WithLockLimit], in the order they were first added.
+//
+// A lock key is listed once even if its lock has been changed, and
+// keys with a lock which is locked are listed too. Keys which are only
+// used as value keys for a [Container] aren't listed. If tracking isn't
+// enabled, Locks returns nil.
+func Locks(ctx context.Context) []any {
+	t, _ := ctx.Value(trackedKey{}).(tracked)
+
+	var keys []any
+	for n := t.head; n != nil; n = n.next {
+		if !n.container {
+			keys = append(keys, n.key)
+		}
+	}
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys
+}
+
+// LockCount returns the number of distinct locks and containers which
+// have been added to ctx since tracking was enabled with [TrackLocks]
+// or [WithLockLimit]. If tracking isn't enabled, LockCount returns 0.
+func LockCount(ctx context.Context) int {
+	t, _ := ctx.Value(trackedKey{}).(tracked)
+	return t.head.len()
+}
+
+// track returns a copy of parent where key is tracked as a lock key,
+// or a value key if container is true. If tracking isn't enabled or the
+// key is already tracked, parent is returned. The second return value
+// is false if tracking the key would exceed the limit.
+func track(parent context.Context, key any, container bool) (context.Context, bool) {
+	t, ok := parent.Value(trackedKey{}).(tracked)
+	if !ok {
+		return parent, true
+	}
+
+	for n := t.head; n != nil; n = n.next {
+		if n.key == key && n.container == container {
+			return parent, true
+		}
+	}
+
+	count := t.head.len() + 1
+	if t.limit > 0 && count > t.limit {
+		return parent, false
+	}
+
+	t.head = &trackedNode{
+		key:       key,
+		container: container,
+		count:     count,
+		next:      t.head,
+	}
+	return context.WithValue(parent, trackedKey{}, t), true
+}
+
+func (n *trackedNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
@@ -0,0 +1,79 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestWithLockLimit(t *testing.T) {
+	ctx := contextlock.Unlock(context.Background(), "before")
+	Equal(t, 0, contextlock.LockCount(ctx))
+
+	ctx = contextlock.WithLockLimit(ctx, 2)
+	ctx = contextlock.Unlock(ctx, "a")
+	ctx = contextlock.WithValue(ctx, "a", "key", "value")
+	Equal(t, 2, contextlock.LockCount(ctx))
+
+	// beyond the limit, the parent is returned unchanged.
+	next := contextlock.Unlock(ctx, "b")
+	Equal(t, ctx, next)
+	False(t, contextlock.Unlocked(next, "b"))
+	next = contextlock.WithValue(ctx, "a", "other", "value")
+	Equal(t, ctx, next)
+
+	// tracked keys can still be replaced.
+	ctx = contextlock.Lock(ctx, "a")
+	False(t, contextlock.Unlocked(ctx, "a"))
+	Equal(t, 2, contextlock.LockCount(ctx))
+
+	// raising the limit keeps the tracked keys.
+	ctx = contextlock.WithLockLimit(ctx, 0)
+	ctx = contextlock.Unlock(ctx, "b")
+	True(t, contextlock.Unlocked(ctx, "b"))
+	Equal(t, 3, contextlock.LockCount(ctx))
+}
+
+func TestWithLockLimitLocking(t *testing.T) {
+	ctx := contextlock.UnlockAll(context.Background(), "a", "b", "c", "d", "e")
+	ctx = contextlock.WithLockLimit(ctx, 1)
+	ctx = contextlock.Unlock(ctx, "tracked")
+
+	// locking is never blocked by the limit, even for untracked keys.
+	ctx = contextlock.Lock(ctx, "a")
+	False(t, contextlock.Unlocked(ctx, "a"))
+	ctx = contextlock.AlwaysLocked(ctx, "b")
+	False(t, contextlock.Unlocked(ctx, "b"))
+	ctx = contextlock.UnpackBools(ctx, []any{"c"}, nil)
+	False(t, contextlock.Unlocked(ctx, "c"))
+	ctx = contextlock.TimeLock(ctx, "d", time.Now().Add(time.Hour))
+	False(t, contextlock.Unlocked(ctx, "d"))
+	ctx = contextlock.FunctionLock(ctx, "e", func(ctx context.Context) bool {
+		return false
+	})
+	False(t, contextlock.Unlocked(ctx, "e"))
+	Equal(t, 1, contextlock.LockCount(ctx))
+
+	// but adding locks for new keys still is.
+	ctx = contextlock.AlwaysUnlocked(ctx, "f")
+	False(t, contextlock.Unlocked(ctx, "f"))
+}
+
+func TestLocks(t *testing.T) {
+	ctx := contextlock.Unlock(context.Background(), "before")
+	Equal(t, []any(nil), contextlock.Locks(ctx))
+
+	ctx = contextlock.TrackLocks(ctx)
+	Equal(t, ctx, contextlock.TrackLocks(ctx))
+
+	ctx = contextlock.Unlock(ctx, "reader")
+	ctx = contextlock.Lock(ctx, "writer")
+	ctx = contextlock.TimeLock(ctx, "scheduled", time.Now().Add(time.Hour))
+	ctx = contextlock.WithValue(ctx, "reader", "name", "Emil")
+	ctx = contextlock.Lock(ctx, "reader")
+
+	Equal(t, []any{"reader", "writer", "scheduled"}, contextlock.Locks(ctx))
+	Equal(t, 4, contextlock.LockCount(ctx))
+}
@@ -4,6 +4,10 @@ package contextlock
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -13,16 +17,35 @@ import (
 // [context.Context] using [WithValue]. Cannot be initialized from
 // outside the contextlock package.
 type Container struct {
-	key   lock
-	value any
+	key      lock
+	valueKey any
+	value    any
+}
+
+// String returns a placeholder for the container which doesn't include
+// the value or the lock key, so that containers can't leak secrets to
+// logs.
+func (c Container) String() string {
+	return "contextlock.Container{redacted}"
+}
+
+// GoString is like [Container.String], for the %#v verb.
+func (c Container) GoString() string {
+	return c.String()
+}
+
+// Format formats the container as [Container.String] for every verb.
+func (c Container) Format(f fmt.State, verb rune) {
+	_, _ = fmt.Fprint(f, c.String())
 }
 
 // lock wraps a key to ensure that a lock can only be unlocked from
 // functions in the contextlock package.
 type lock any
 
-// timestamp combines a [time.Time] with a function that returns a
-// time.Time for the current time to allow overriding [time.Now].
+// timestamp combines a [time.Time] with an optional function that
+// returns a time.Time for the current time to allow overriding
+// [time.Now].
 type timestamp struct {
 	Time       time.Time
 	TimeSource func() time.Time
@@ -33,10 +56,20 @@ type TimestampOption func(timestamp) timestamp
 
 type lockFunction func(ctx context.Context) bool
 
+// always is the lock value stored by [AlwaysUnlocked] and
+// [AlwaysLocked].
+type always bool
+
+// allowlist is the set of lock keys which may be unlocked in a context
+// created by [OnlyUnlock].
+type allowlist map[any]struct{}
+
+type allowlistKey struct{}
+
 // Unlock returns a copy of parent where the lock behind lockKey is
 // unlocked.
 func Unlock(parent context.Context, lockKey any) context.Context {
-	return context.WithValue(parent, lock(lockKey), true)
+	return withLock(parent, lockKey, true)
 }
 
 // Lock returns a copy of parent where the lock behind lockKey is
@@ -46,35 +79,121 @@ func Unlock(parent context.Context, lockKey any) context.Context {
 // explicitly unlocked, calling this function is only necessary if you
 // want to lock a previously unlocked lock.
 func Lock(parent context.Context, lockKey any) context.Context {
-	return context.WithValue(parent, lock(lockKey), false)
+	return withLock(parent, lockKey, false)
+}
+
+// UnlockAll returns a copy of parent where the locks behind lockKeys
+// are unlocked.
+//
+// It's equivalent to calling [Unlock] for each of lockKeys in order, so
+// hooks and checks such as [WithKeyCollisionCheck] and [WithLockLimit]
+// see the keys in the order they're passed, and a key which is passed
+// more than once ends up in the state it was last set to.
+func UnlockAll(parent context.Context, lockKeys ...any) context.Context {
+	ctx := parent
+	for _, lockKey := range lockKeys {
+		ctx = Unlock(ctx, lockKey)
+	}
+	return ctx
+}
+
+// UnlockAllReverse works like [UnlockAll] but unlocks the locks in the
+// reverse order of lockKeys, for unwinding a stack of locks which were
+// set up in order.
+func UnlockAllReverse(parent context.Context, lockKeys ...any) context.Context {
+	ctx := parent
+	for i := len(lockKeys) - 1; i >= 0; i-- {
+		ctx = Unlock(ctx, lockKeys[i])
+	}
+	return ctx
+}
+
+// LockAll returns a copy of parent where the locks behind lockKeys are
+// locked.
+//
+// It's equivalent to calling [Lock] for each of lockKeys in order, see
+// [UnlockAll].
+func LockAll(parent context.Context, lockKeys ...any) context.Context {
+	ctx := parent
+	for _, lockKey := range lockKeys {
+		ctx = Lock(ctx, lockKey)
+	}
+	return ctx
+}
+
+// AlwaysUnlocked returns a copy of parent where the lock behind lockKey
+// is always unlocked.
+//
+// It's equivalent to a [FunctionLock] which always returns true, and
+// clearer than [Unlock] for default-open configurations since
+// [LockStatus] reports the lock as being always unlocked.
+func AlwaysUnlocked(parent context.Context, lockKey any) context.Context {
+	return withLock(parent, lockKey, always(true))
+}
+
+// AlwaysLocked returns a copy of parent where the lock behind lockKey
+// is always locked.
+//
+// It's equivalent to a [FunctionLock] which always returns false, see
+// [AlwaysUnlocked].
+func AlwaysLocked(parent context.Context, lockKey any) context.Context {
+	return withLock(parent, lockKey, always(false))
+}
+
+// OnlyUnlock returns a copy of parent where the locks behind keys are
+// unlocked and every other lock is locked.
+//
+// Locks which are unlocked in parent but not listed in keys are locked
+// in the returned context and in every context derived from it, even
+// if they're unlocked again with [Unlock]. The listed keys can still be
+// locked with [Lock]. Calling OnlyUnlock on a context derived from the
+// returned context replaces the set of allowed keys.
+func OnlyUnlock(parent context.Context, keys ...any) context.Context {
+	allowed := make(allowlist, len(keys))
+	ctx := parent
+	for _, lockKey := range keys {
+		allowed[lockKey] = struct{}{}
+		ctx = Unlock(ctx, lockKey)
+	}
+	return context.WithValue(ctx, allowlistKey{}, allowed)
+}
+
+// withLock returns a copy of parent where val is stored as the lock
+// value for lockKey.
+func withLock(parent context.Context, lockKey any, val any) context.Context {
+	checkCollision(parent, lockKey, false)
+	ctx, ok := track(parent, lockKey, false)
+	if !ok && lockValue(parent, lockKey) == nil {
+		// without a lock, the key is locked already.
+		return parent
+	}
+	return context.WithValue(ctx, lock(lockKey), val)
 }
 
 // TimeLock returns a copy of parent where the lock will be unlocked
 // at a provided point in time.
 func TimeLock(parent context.Context, lockKey any, t time.Time, opts ...TimestampOption) context.Context {
-	ts := timestamp{Time: t, TimeSource: time.Now}
-	for _, o := range opts {
-		ts = o(ts)
-	}
-
-	return context.WithValue(parent, lock(lockKey), ts)
+	return withLock(parent, lockKey, newTimestamp(parent, t, opts))
 }
 
 // FunctionLock returns a copy of parent where the lock calls fn to
 // check whether it's unlocked.
 //
 // The lock is unlocked when fn returns true and locked when fn returns
-// false. The context at the time of calling [Unlocked] will be passed
-// as the sole argument to the fn function. The fn function must have
-// the following signature:
+// false or panics, see [WithPanicObserver] and [WithStrictUnlockers].
+// A copy of the context at the time of calling [Unlocked] will be
+// passed as the sole argument to the fn function, see [WithMaxDepth]
+// for how nested evaluation is limited. The fn function must have the
+// following signature:
 //
 //	fn(ctx context.Context) bool
 func FunctionLock(parent context.Context, lockKey any, fn lockFunction) context.Context {
-	return context.WithValue(parent, lock(lockKey), fn)
+	return withLock(parent, lockKey, fn)
 }
 
 // TimeSource can be passed as a functional option to [TimeLock] to
-// override [time.Now] when checking whether a lock is open or not.
+// override [time.Now] when checking whether a lock is open or not. It
+// takes precedence over a clock set with [WithClock].
 func TimeSource(fn func() time.Time) TimestampOption {
 	return func(t timestamp) timestamp {
 		t.TimeSource = fn
@@ -84,13 +203,132 @@ func TimeSource(fn func() time.Time) TimestampOption {
 
 // Unlocked returns true if the lock behind lockKey in ctx is unlocked.
 func Unlocked(ctx context.Context, lockKey any) bool {
-	switch val := ctx.Value(lock(lockKey)).(type) {
+	val := lockValue(ctx, lockKey)
+	ctx = withEvalCounter(ctx, lockKey)
+
+	var unlocked bool
+	if t, ok := ctx.Value(traceKey{}).(*tracer); ok {
+		i := t.begin(ctx, lockKey, kindOf(val))
+		unlocked = resolve(ctx, lockKey, val)
+		t.end(i, unlocked)
+	} else {
+		unlocked = resolve(ctx, lockKey, val)
+	}
+
+	for _, hook := range accessHooks(ctx) {
+		hook(lockKey, unlocked)
+	}
+	return unlocked
+}
+
+// lockValue returns the lock value for lockKey in ctx.
+func lockValue(ctx context.Context, lockKey any) any {
+	if val := ctx.Value(lock(lockKey)); val != nil {
+		return val
+	}
+	return selfGate(ctx, lockKey)
+}
+
+// SelfCheck returns an error if any of the locks behind the keys in
+// mustBeLocked are unlocked in ctx.
+//
+// This is meant as a cheap sanity check at trust boundaries to catch
+// misconfigured contexts before proceeding. The error lists every key
+// which is unlocked, formatted with %v.
+func SelfCheck(ctx context.Context, mustBeLocked ...any) error {
+	var unlocked []string
+	for _, lockKey := range mustBeLocked {
+		if Unlocked(ctx, lockKey) {
+			unlocked = append(unlocked, fmt.Sprintf("%v", lockKey))
+		}
+	}
+
+	if len(unlocked) > 0 {
+		return fmt.Errorf("contextlock: expected locks to be locked: %s", strings.Join(unlocked, ", "))
+	}
+	return nil
+}
+
+// resolve returns true if the lock behind lockKey with the lock value
+// val is unlocked in ctx, taking context wide settings such as
+// [OnlyUnlock], [WithGlobalUnlockDeadline] and [LockGroup] into
+// account.
+func resolve(ctx context.Context, lockKey any, val any) bool {
+	if _, expired := expiredDeadline(ctx); expired {
+		return false
+	}
+
+	if allowed, ok := ctx.Value(allowlistKey{}).(allowlist); ok {
+		if _, ok := allowed[lockKey]; !ok {
+			return false
+		}
+	}
+
+	if !nests(val) {
+		return evaluate(ctx, val) || groupUnlocked(ctx, lockKey)
+	}
+
+	entered, e, ok := enter(ctx, lockKey)
+	if !ok {
+		return false
+	}
+	unlocked := evaluate(entered, val)
+	if e.tripped.Load() {
+		return false
+	}
+	return unlocked || groupUnlocked(ctx, lockKey)
+}
+
+// evaluate returns true if the lock value val is unlocked in ctx.
+func evaluate(ctx context.Context, val any) bool {
+	switch val := val.(type) {
 	case bool:
 		return val
-	case timestamp:
-		return val.Time.Before(val.TimeSource())
+	case always:
+		return bool(val)
+	case precomputed:
+		return val.Unlocked
+	case timestamp, window, deadline, freshness, jittered, grant, rateLimited,
+		condition, sdkFlag, healthy, firstSeen:
+		return guarded(ctx, val.(valueLock))
+	case equals:
+		return reflect.DeepEqual(ctx.Value(val.Key), val.Expected)
+	case match:
+		return val.unlocked(ctx)
+	case before:
+		return val.unlocked(ctx)
+	case trusted:
+		marked, _ := ctx.Value(trustRootKey{root: val.Root}).(bool)
+		return val.Root != nil && marked
+	case hasDeadline:
+		_, ok := ctx.Deadline()
+		return ok
+	case counted:
+		return val.unlocked()
+	case scoped:
+		return !val.Ended.Load()
+	case once:
+		return val.Used.CompareAndSwap(false, true)
+	case exclusive:
+		return val.unlocked(ctx)
+	case all:
+		return val.unlocked(ctx)
+	case anyOf:
+		return val.unlocked(ctx)
+	case namedQuorum:
+		return val.unlocked(ctx)
+	case not:
+		return val.unlocked(ctx)
+	case custom:
+		return val.unlocked(ctx)
+	case gate:
+		return val.unlocked(ctx)
+	case errLockFunction:
+		return val.unlocked(ctx)
+	case cachedFunction:
+		return val.unlocked(ctx)
 	case lockFunction:
-		return val(ctx)
+		return val.unlocked(ctx)
 	default:
 		return false
 	}
@@ -103,40 +341,137 @@ func Unlocked(ctx context.Context, lockKey any) bool {
 // type [Container] and will refuse to return the value until the
 // lockKey has been unlocked with [Unlock].
 func WithValue(parent context.Context, lockKey, key, value any) context.Context {
-	return context.WithValue(parent, key, Container{
-		key:   lock(lockKey),
-		value: value,
+	return withContainer(parent, key, Container{
+		key:      lock(lockKey),
+		valueKey: key,
+		value:    value,
 	})
 }
 
+// withContainer returns a copy of parent where c is stored under key.
+func withContainer(parent context.Context, key any, c protected) context.Context {
+	checkCollision(parent, key, true)
+	ctx, ok := track(parent, key, true)
+	if !ok {
+		return parent
+	}
+	return context.WithValue(ctx, key, c)
+}
+
+// protected is implemented by [Container] and [TypedContainer].
+type protected interface {
+	// container returns the value as a Container.
+	container() Container
+	// relock returns a copy of the container guarded by lockKey.
+	relock(lockKey any) protected
+}
+
+// asContainer returns v as a [Container] if it's a Container or a
+// [TypedContainer].
+func asContainer(v any) (Container, bool) {
+	p, ok := v.(protected)
+	if !ok {
+		return Container{}, false
+	}
+	return p.container(), true
+}
+
+func (c Container) container() Container {
+	return c
+}
+
+func (c Container) relock(lockKey any) protected {
+	c.key = lock(lockKey)
+	return c
+}
+
+// WithUnlockedValue returns a copy of parent in which the key is
+// associated with a [Container] containing the value behind lockKey,
+// and where lockKey is unlocked.
+//
+// It's a shorthand for calling [WithValue] followed by [Unlock], which
+// is mostly useful when setting up contexts in tests.
+func WithUnlockedValue(parent context.Context, lockKey, key, value any) context.Context {
+	return Unlock(WithValue(parent, lockKey, key, value), lockKey)
+}
+
+// WithValues returns a copy of parent in which each key in kv is
+// associated with a [Container] containing its value behind lockKey,
+// as if [WithValue] was called for every key.
+//
+// Since the keys of a map are distinct, the order in which the values
+// are added doesn't affect the result, unless the limit set with
+// [WithLockLimit] is reached, in which case which of the values are
+// added is unspecified.
+func WithValues(parent context.Context, lockKey any, kv map[any]any) context.Context {
+	ctx := parent
+	for key, value := range kv {
+		ctx = WithValue(ctx, lockKey, key, value)
+	}
+	return ctx
+}
+
 // Value returns the value contained in the container if and only if
 // the container's lock in ctx is unlocked.
 //
 // The first value is the item stored in the container, or nil if the
 // lock is locked. The second value returned is a boolean which is false
 // if the container is locked and true otherwise.
+//
+// The read is recorded by the [AuditSink] in ctx, like a read with
+// [Value].
 func (c Container) Value(ctx context.Context) (any, bool) {
+	value, ok, _ := c.access(ctx)
+	return value, ok
+}
+
+// access reads the value of the container like [Container.Value] and
+// records the read to the audit sink in ctx. granted is true if the
+// lock is unlocked and the value could be read.
+func (c Container) access(ctx context.Context) (value any, ok bool, granted bool) {
 	if !Unlocked(ctx, c.key) {
-		return nil, false
+		recordAccess(ctx, c, c.valueKey, false)
+		value, ok = c.locked()
+		return value, ok, false
+	}
+
+	value, ok = c.unwrap(ctx)
+	recordAccess(ctx, c, c.valueKey, ok)
+	return value, ok, ok
+}
+
+// locked returns the value of a locked container, which is nil and
+// false unless the container holds a [WithTieredValue].
+func (c Container) locked() (any, bool) {
+	if t, ok := c.value.(tiered); ok {
+		return t.limited, true
 	}
+	return nil, false
+}
 
+// unwrap returns the value of the container without checking the lock.
+func (c Container) unwrap(ctx context.Context) (any, bool) {
+	if r, ok := c.value.(reader); ok {
+		return r.read(ctx)
+	}
 	return c.value, true
 }
 
 // Value returns the stored value for the given key. If the key is a
-// [Container] added with [WithValue], the container will be unwrapped
-// and [Container.Value] will be called.
+// [Container] added with [WithValue], or a [TypedContainer] added with
+// [WithTypedValue], the container will be unwrapped and
+// [Container.Value] will be called.
 //
 // If the value is not a container, (value, false) is returned.
 // If the value is a container and the lock is locked, (nil, false) is
-// returned.
+// returned, except for containers added with [WithTieredValue].
 // If the value is a container and the lock is unlocked, (value, true)
 // is returned.
 //
 // Calls [context.Context.Value] for the ctx with the given key.
 func Value(ctx context.Context, key any) (any, bool) {
 	value := ctx.Value(key)
-	container, ok := value.(Container)
+	container, ok := asContainer(value)
 	if !ok {
 		// the value is not protected by the contextlock package,
 		// we return it but also false to indicate that there wasn't
@@ -146,3 +481,58 @@ func Value(ctx context.Context, key any) (any, bool) {
 
 	return container.Value(ctx)
 }
+
+// ValueOr returns the value for key like [Value] if it's available,
+// and fallback if the container is locked, the key doesn't hold a
+// [Container] or the key is missing.
+func ValueOr(ctx context.Context, key any, fallback any) any {
+	value, ok := Value(ctx, key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+// MustValue works like [Value] but panics if the value isn't
+// available, for code paths where a locked container is a programming
+// error.
+//
+// The panic message includes the key formatted with %v and tells apart
+// a missing key, a key which doesn't hold a [Container] and a locked
+// container.
+func MustValue(ctx context.Context, key any) any {
+	value, code, ok := ValueOrReason(ctx, key)
+	if ok {
+		return value
+	}
+
+	switch code {
+	case ReasonMissing:
+		panic(fmt.Sprintf("contextlock: missing key %v", key))
+	case ReasonNotContainer:
+		panic(fmt.Sprintf("contextlock: value for key %v is not a container", key))
+	case ReasonUnavailable:
+		panic(fmt.Sprintf("contextlock: value for key %v is unavailable", key))
+	default:
+		panic(fmt.Sprintf("contextlock: locked container for key %v", key))
+	}
+}
+
+// ValueJSON returns the JSON encoding of the value for key if it's
+// stored in an unlocked [Container], see [Value].
+//
+// If the value isn't available, ValueJSON returns (nil, false, nil).
+// If the value is available but cannot be encoded by [json.Marshal],
+// the error is returned together with true.
+func ValueJSON(ctx context.Context, key any) ([]byte, bool, error) {
+	value, ok := Value(ctx, key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, true, err
+	}
+	return data, true, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,6 +79,24 @@ func TestWithValue(t *testing.T) {
 	Nil(t, v)
 }
 
+func TestWithUnlockedValue(t *testing.T) {
+	type lock struct{}
+
+	const key = "key"
+	const value = "value"
+
+	ctx := contextlock.WithUnlockedValue(context.Background(), lock{}, key, value)
+
+	v, ok := contextlock.Value(ctx, key)
+	True(t, ok)
+	Equal(t, value, v)
+
+	// locking the lock again hides the value.
+	v, ok = contextlock.Value(contextlock.Lock(ctx, lock{}), key)
+	False(t, ok)
+	Nil(t, v)
+}
+
 func TestDifferentLocks(t *testing.T) {
 	type lockA struct{}
 	type lockB struct{}
@@ -188,3 +207,212 @@ func TestFunctionLock(t *testing.T) {
 		})
 	}
 }
+
+func TestSelfCheck(t *testing.T) {
+	ctx := contextlock.Lock(context.Background(), "admin")
+	ctx = contextlock.Unlock(ctx, "reader")
+
+	Nil(t, contextlock.SelfCheck(ctx))
+	Nil(t, contextlock.SelfCheck(ctx, "admin", "sudo"))
+
+	err := contextlock.SelfCheck(ctx, "admin", "reader", "sudo")
+	True(t, err != nil)
+	Equal(t, "contextlock: expected locks to be locked: reader", err.Error())
+}
+
+func TestValueJSON(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, map[string]int{"answer": 42})
+
+	data, ok, err := contextlock.ValueJSON(ctx, key)
+	Nil(t, err)
+	False(t, ok)
+	Equal(t, []byte(nil), data)
+
+	data, ok, err = contextlock.ValueJSON(contextlock.Unlock(ctx, lock{}), key)
+	Nil(t, err)
+	True(t, ok)
+	Equal(t, `{"answer":42}`, string(data))
+
+	ctx = contextlock.WithUnlockedValue(context.Background(), lock{}, key, make(chan int))
+	data, ok, err = contextlock.ValueJSON(ctx, key)
+	True(t, err != nil)
+	True(t, ok)
+	Equal(t, []byte(nil), data)
+}
+
+func TestOnlyUnlock(t *testing.T) {
+	ctx := contextlock.Unlock(context.Background(), "previously")
+	ctx = contextlock.FunctionLock(ctx, "function", func(ctx context.Context) bool { return true })
+
+	ctx = contextlock.OnlyUnlock(ctx, "reader", "writer")
+	True(t, contextlock.Unlocked(ctx, "reader"))
+	True(t, contextlock.Unlocked(ctx, "writer"))
+	False(t, contextlock.Unlocked(ctx, "previously"))
+	False(t, contextlock.Unlocked(ctx, "function"))
+
+	// listed keys can be locked, others can't be unlocked.
+	ctx = contextlock.Lock(ctx, "writer")
+	ctx = contextlock.Unlock(ctx, "previously")
+	False(t, contextlock.Unlocked(ctx, "writer"))
+	False(t, contextlock.Unlocked(ctx, "previously"))
+}
+
+func TestValueOr(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+	Equal(t, any("fallback"), contextlock.ValueOr(ctx, key, "fallback"))
+	Equal(t, any("fallback"), contextlock.ValueOr(ctx, "missing", "fallback"))
+
+	ctx = contextlock.Unlock(ctx, lock{})
+	Equal(t, any("value"), contextlock.ValueOr(ctx, key, "fallback"))
+}
+
+func TestMustValue(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	mustPanic := func(t *testing.T, ctx context.Context, expected string) {
+		t.Helper()
+
+		defer func() {
+			t.Helper()
+			Equal(t, any(expected), recover())
+		}()
+		contextlock.MustValue(ctx, key)
+		t.Fatal("expected panic")
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		mustPanic(t, context.Background(), "contextlock: missing key key")
+	})
+
+	t.Run("not container", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), key, "value")
+		mustPanic(t, ctx, "contextlock: value for key key is not a container")
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+		mustPanic(t, ctx, "contextlock: locked container for key key")
+	})
+
+	t.Run("unlocked", func(t *testing.T) {
+		ctx := contextlock.WithUnlockedValue(context.Background(), lock{}, key, "value")
+		Equal(t, any("value"), contextlock.MustValue(ctx, key))
+	})
+}
+
+func TestAlwaysUnlocked(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.AlwaysUnlocked(context.Background(), lock{})
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	unlocked, reason := contextlock.LockStatus(ctx, lock{})
+	True(t, unlocked)
+	Equal(t, "always unlocked", reason)
+
+	ctx = contextlock.AlwaysLocked(ctx, lock{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	unlocked, reason = contextlock.LockStatus(ctx, lock{})
+	False(t, unlocked)
+	Equal(t, "always locked", reason)
+	Equal(t, contextlock.KindBool, contextlock.LockKind(ctx, lock{}))
+}
+
+func TestContainerString(t *testing.T) {
+	const secret = "hunter2"
+	const lock = "vault"
+
+	ctx := contextlock.WithUnlockedValue(context.Background(), lock, "password", secret)
+	ctx = contextlock.WithTypedValue(ctx, lock, "typed", secret)
+
+	for _, key := range []string{"password", "typed"} {
+		container := ctx.Value(key)
+		for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+			s := fmt.Sprintf(format, container)
+			False(t, strings.Contains(s, secret))
+			False(t, strings.Contains(s, lock))
+		}
+	}
+	Equal(t, "contextlock.Container{redacted}", fmt.Sprint(ctx.Value("password")))
+	Equal(t, "contextlock.TypedContainer{redacted}", fmt.Sprintf("%#v", ctx.Value("typed")))
+}
+
+func TestUnlockAll(t *testing.T) {
+	keys := []any{"reader", "writer", "admin"}
+
+	ctx := contextlock.UnlockAll(context.Background(), keys...)
+	for _, lockKey := range keys {
+		True(t, contextlock.Unlocked(ctx, lockKey))
+	}
+	False(t, contextlock.Unlocked(ctx, "other"))
+
+	ctx = contextlock.LockAll(ctx, keys[1:]...)
+	True(t, contextlock.Unlocked(ctx, "reader"))
+	False(t, contextlock.Unlocked(ctx, "writer"))
+	False(t, contextlock.Unlocked(ctx, "admin"))
+
+	// keys are applied in the order they are passed.
+	ctx = contextlock.WithLockLimit(context.Background(), 0)
+	ctx = contextlock.UnlockAll(ctx, "b", "a", "b")
+	Equal(t, []any{"b", "a"}, contextlock.Locks(ctx))
+
+	// a duplicate key ends up in the state it was last set to.
+	ctx = contextlock.LockAll(contextlock.UnlockAll(ctx, "c"), "c", "c")
+	False(t, contextlock.Unlocked(ctx, "c"))
+	ctx = contextlock.UnlockAll(contextlock.Lock(ctx, "c"), "c", "c")
+	True(t, contextlock.Unlocked(ctx, "c"))
+}
+
+func TestUnlockAllOrder(t *testing.T) {
+	keys := []any{"first", "second", "third"}
+
+	var seen []any
+	ctx := contextlock.WithKeyCollisionCheck(context.Background(), func(key any) {
+		seen = append(seen, key)
+	})
+	for _, key := range keys {
+		ctx = context.WithValue(ctx, key, "value")
+	}
+
+	contextlock.UnlockAll(ctx, keys...)
+	Equal(t, keys, seen)
+
+	seen = nil
+	reversed := contextlock.UnlockAllReverse(ctx, keys...)
+	Equal(t, []any{"third", "second", "first"}, seen)
+	for _, key := range keys {
+		True(t, contextlock.Unlocked(reversed, key))
+	}
+
+	tracked := contextlock.UnlockAllReverse(contextlock.TrackLocks(context.Background()), keys...)
+	Equal(t, []any{"third", "second", "first"}, contextlock.Locks(tracked))
+}
+
+func TestWithValues(t *testing.T) {
+	type lock struct{}
+
+	kv := map[any]any{
+		"username": "admin",
+		"password": "hunter2",
+		"token":    42,
+	}
+
+	ctx := contextlock.WithValues(context.Background(), lock{}, kv)
+	for key := range kv {
+		_, ok := contextlock.Value(ctx, key)
+		False(t, ok)
+	}
+
+	ctx = contextlock.Unlock(ctx, lock{})
+	for key, expected := range kv {
+		v, ok := contextlock.Value(ctx, key)
+		True(t, ok)
+		Equal(t, expected, v)
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"reflect"
+)
+
+// PackBools returns a compact bitset of whether the locks behind keys
+// are unlocked in ctx, where bit i is set if keys[i] is unlocked.
+//
+// Bits are packed starting with the least significant bit of the first
+// byte, and the result is (len(keys) + 7) / 8 bytes long, making it
+// small enough for cookies and headers. The keys themselves aren't
+// included, so [UnpackBools] must be called with the same keys in the
+// same order.
+func PackBools(ctx context.Context, keys []any) []byte {
+	data := make([]byte, (len(keys)+7)/8)
+	for i, lockKey := range keys {
+		if Unlocked(ctx, lockKey) {
+			data[i/8] |= 1 << (i % 8)
+		}
+	}
+	return data
+}
+
+// UnpackBools returns a copy of parent where each of the locks behind
+// keys is unlocked or locked according to a bitset created by
+// [PackBools] with the same keys in the same order.
+//
+// Keys without a corresponding bit in data, because data is too short,
+// are locked.
+func UnpackBools(parent context.Context, keys []any, data []byte) context.Context {
+	ctx := parent
+	for i, lockKey := range keys {
+		if i/8 < len(data) && data[i/8]&(1<<(i%8)) != 0 {
+			ctx = Unlock(ctx, lockKey)
+		} else {
+			ctx = Lock(ctx, lockKey)
+		}
+	}
+	return ctx
+}
+
+// Decide returns a T where each bool field named by a key in mapping is
+// set to whether the lock behind the corresponding lock key is unlocked
+// in ctx, for passing a typed set of decisions to templates and other
+// code that shouldn't see the context.
+//
+// T must be a struct type, otherwise the zero value of T is returned.
+// Since the fields are set using reflection, only exported fields of
+// type bool can be set. Names which don't match such a field are
+// ignored, and fields which aren't named in mapping are false.
+func Decide[T any](ctx context.Context, mapping map[string]any) T {
+	var decision T
+	v := reflect.ValueOf(&decision).Elem()
+	if v.Kind() != reflect.Struct {
+		return decision
+	}
+
+	for name, lockKey := range mapping {
+		f := v.FieldByName(name)
+		if !f.IsValid() || !f.CanSet() || f.Kind() != reflect.Bool {
+			continue
+		}
+		f.SetBool(Unlocked(ctx, lockKey))
+	}
+	return decision
+}
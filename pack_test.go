@@ -0,0 +1,64 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestPackBools(t *testing.T) {
+	keys := []any{}
+	for i := 0; i < 12; i++ {
+		keys = append(keys, i)
+	}
+
+	ctx := context.Background()
+	for _, i := range []int{0, 3, 8, 11} {
+		ctx = contextlock.Unlock(ctx, i)
+	}
+	ctx = contextlock.Lock(ctx, 4)
+
+	data := contextlock.PackBools(ctx, keys)
+	Equal(t, []byte{0b00001001, 0b00001001}, data)
+
+	restored := contextlock.UnpackBools(contextlock.Unlock(context.Background(), 5), keys, data)
+	for _, lockKey := range keys {
+		Equal(t, contextlock.Unlocked(ctx, lockKey), contextlock.Unlocked(restored, lockKey))
+	}
+
+	// missing bits are locked.
+	restored = contextlock.UnpackBools(context.Background(), keys, data[:1])
+	True(t, contextlock.Unlocked(restored, 3))
+	False(t, contextlock.Unlocked(restored, 8))
+}
+
+func TestDecide(t *testing.T) {
+	type reader struct{}
+	type writer struct{}
+	type admin struct{}
+
+	type decision struct {
+		CanRead  bool
+		CanWrite bool
+		IsAdmin  bool
+		Name     string
+		internal bool
+	}
+
+	ctx := contextlock.Unlock(context.Background(), reader{})
+	ctx = contextlock.Unlock(ctx, writer{})
+	ctx = contextlock.Unlock(ctx, admin{})
+	ctx = contextlock.Lock(ctx, writer{})
+
+	d := contextlock.Decide[decision](ctx, map[string]any{
+		"CanRead":  reader{},
+		"CanWrite": writer{},
+		"Name":     admin{},
+		"internal": admin{},
+		"Missing":  admin{},
+	})
+	Equal(t, decision{CanRead: true}, d)
+
+	Equal(t, 0, contextlock.Decide[int](ctx, map[string]any{"CanRead": reader{}}))
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+// precomputed is the lock value stored by [Precompute].
+type precomputed struct {
+	Unlocked bool
+	Kind     Kind
+}
+
+// Precompute returns a copy of parent where the locks behind keys have
+// been evaluated once and replaced with the result.
+//
+// This is useful for handlers which check the same locks many times,
+// since subsequent calls to [Unlocked] and [Value] read the stored
+// result instead of calling functions or reading clocks again. The
+// results are frozen for the lifetime of the returned context, so a
+// [TimeLock] that would unlock later or a [FunctionLock] that would
+// return a different result stays as it was when Precompute was
+// called. The locks can still be changed with [Lock] and [Unlock] in
+// derived contexts.
+func Precompute(ctx context.Context, keys ...any) context.Context {
+	results := make([]precomputed, len(keys))
+	for i, lockKey := range keys {
+		results[i] = precomputed{
+			Unlocked: Unlocked(ctx, lockKey),
+			Kind:     LockKind(ctx, lockKey),
+		}
+	}
+
+	for i, lockKey := range keys {
+		ctx = withLock(ctx, lockKey, results[i])
+	}
+	return ctx
+}
@@ -0,0 +1,64 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestPrecompute(t *testing.T) {
+	type expensive struct{}
+	type scheduled struct{}
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	var calls int
+	ctx := contextlock.FunctionLock(context.Background(), expensive{}, func(ctx context.Context) bool {
+		calls++
+		return true
+	})
+	ctx = contextlock.TimeLock(ctx, scheduled{}, t0.Add(time.Hour), contextlock.TimeSource(nowFn))
+
+	ctx = contextlock.Precompute(ctx, expensive{}, scheduled{})
+	Equal(t, 1, calls)
+
+	for i := 0; i < 10; i++ {
+		True(t, contextlock.Unlocked(ctx, expensive{}))
+	}
+	Equal(t, 1, calls)
+
+	// the time lock stays locked after its unlock time.
+	tNow = t0.Add(2 * time.Hour)
+	False(t, contextlock.Unlocked(ctx, scheduled{}))
+	Equal(t, contextlock.KindTime, contextlock.LockKind(ctx, scheduled{}))
+
+	// precomputed locks can be changed explicitly.
+	True(t, contextlock.Unlocked(contextlock.Unlock(ctx, scheduled{}), scheduled{}))
+}
+
+func BenchmarkUnlocked(b *testing.B) {
+	type lock struct{}
+
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		return contextlock.Unlocked(ctx, "a") && contextlock.Unlocked(ctx, "b")
+	})
+	ctx = contextlock.Unlock(ctx, "a")
+	ctx = contextlock.Unlock(ctx, "b")
+
+	b.Run("function lock", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			contextlock.Unlocked(ctx, lock{})
+		}
+	})
+
+	b.Run("precomputed", func(b *testing.B) {
+		ctx := contextlock.Precompute(ctx, lock{})
+		for i := 0; i < b.N; i++ {
+			contextlock.Unlocked(ctx, lock{})
+		}
+	})
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"errors"
+)
+
+// Reason codes returned by [ValueOrReason] when a value isn't
+// available. The codes are stable and meant to be passed on to clients,
+// for example in the body of an HTTP 403 response.
+const (
+	// ReasonMissing means that there is no value for the key.
+	ReasonMissing = "missing"
+	// ReasonNotContainer means that the value for the key isn't
+	// protected by a [Container].
+	ReasonNotContainer = "not_container"
+	// ReasonLocked means that the container's lock is locked, or that
+	// it has never been unlocked.
+	ReasonLocked = "locked"
+	// ReasonLockedTime means that the container is guarded by a time
+	// based lock which is locked.
+	ReasonLockedTime = "locked_time"
+	// ReasonLockedFunction means that the container is guarded by a
+	// [FunctionLock] which is locked.
+	ReasonLockedFunction = "locked_function"
+	// ReasonLockedValue means that the container is guarded by a lock
+	// depending on the context which is locked.
+	ReasonLockedValue = "locked_value"
+	// ReasonLockedComposite means that the container is guarded by a
+	// lock depending on other locks which is locked.
+	ReasonLockedComposite = "locked_composite"
+	// ReasonLockedCustom means that the container is guarded by a
+	// [CustomLock] which is locked.
+	ReasonLockedCustom = "locked_custom"
+	// ReasonUnavailable means that the container is unlocked but its
+	// value couldn't be read, such as when decryption fails for
+	// [WithEncryptedValue].
+	ReasonUnavailable = "unavailable"
+)
+
+// Errors returned by [ValueE].
+var (
+	// ErrLocked means that the container's lock is locked or that the
+	// value couldn't be read from the container.
+	ErrLocked = errors.New("contextlock: container is locked")
+	// ErrNoContainer means that there is no value for the key, or that
+	// the value isn't protected by a [Container].
+	ErrNoContainer = errors.New("contextlock: no container for key")
+)
+
+// ValueE works like [Value] but returns an error when the value isn't
+// available, which is [ErrNoContainer] if the key is missing or doesn't
+// hold a [Container] and [ErrLocked] otherwise.
+//
+// Unlike Value, the value is nil when the key holds a value which isn't
+// protected by a container.
+func ValueE(ctx context.Context, key any) (any, error) {
+	value, code, ok := ValueOrReason(ctx, key)
+	if ok {
+		return value, nil
+	}
+
+	switch code {
+	case ReasonMissing, ReasonNotContainer:
+		return nil, ErrNoContainer
+	default:
+		return nil, ErrLocked
+	}
+}
+
+// State describes whether a value is available, see [ValueState].
+type State int
+
+const (
+	// StateAbsent means that there is no value for the key.
+	StateAbsent State = iota
+	// StateNotContainer means that the value for the key isn't
+	// protected by a [Container].
+	StateNotContainer
+	// StateLocked means that the container's lock is locked, or that
+	// the value couldn't be read from the container. The limited
+	// value of a container added with [WithTieredValue] is still
+	// available.
+	StateLocked
+	// StateUnlocked means that the container's lock is unlocked and
+	// the value is available.
+	StateUnlocked
+)
+
+// String returns a lowercase name for the state.
+func (s State) String() string {
+	switch s {
+	case StateAbsent:
+		return "absent"
+	case StateNotContainer:
+		return "not_container"
+	case StateLocked:
+		return "locked"
+	case StateUnlocked:
+		return "unlocked"
+	default:
+		return "unknown"
+	}
+}
+
+// ValueState works like [Value] but returns the [State] of the value
+// instead of a boolean, to tell apart a missing key, a key which isn't
+// protected by a [Container] and a locked container.
+//
+// The value is returned for StateUnlocked, and like Value, the value
+// is returned as is for StateNotContainer. A locked container added
+// with [WithTieredValue] is StateLocked, and its limited value is
+// returned.
+func ValueState(ctx context.Context, key any) (any, State) {
+	raw := ctx.Value(key)
+	if raw == nil {
+		return nil, StateAbsent
+	}
+
+	container, ok := asContainer(raw)
+	if !ok {
+		return raw, StateNotContainer
+	}
+
+	value, _, granted := container.access(ctx)
+	if !granted {
+		return value, StateLocked
+	}
+	return value, StateUnlocked
+}
+
+// ValueOrReason works like [Value] but also returns a reason code
+// explaining why the value isn't available when ok is false.
+//
+// The code is one of the Reason constants, such as [ReasonLockedTime],
+// and is empty when ok is true. Unlike Value, the value is nil when the
+// key holds a value which isn't protected by a [Container].
+func ValueOrReason(ctx context.Context, key any) (value any, code string, ok bool) {
+	raw := ctx.Value(key)
+	if raw == nil {
+		return nil, ReasonMissing, false
+	}
+
+	container, ok := asContainer(raw)
+	if !ok {
+		return nil, ReasonNotContainer, false
+	}
+
+	if !Unlocked(ctx, container.key) {
+		recordAccess(ctx, container, key, false)
+		if value, ok := container.locked(); ok {
+			return value, "", true
+		}
+		return nil, lockedReason(LockKind(ctx, container.key)), false
+	}
+
+	value, ok = container.unwrap(ctx)
+	recordAccess(ctx, container, key, ok)
+	if !ok {
+		return nil, ReasonUnavailable, false
+	}
+	return value, "", true
+}
+
+// lockedReason returns the reason code for a locked lock of kind.
+func lockedReason(kind Kind) string {
+	switch kind {
+	case KindTime:
+		return ReasonLockedTime
+	case KindFunction:
+		return ReasonLockedFunction
+	case KindValue:
+		return ReasonLockedValue
+	case KindComposite:
+		return ReasonLockedComposite
+	case KindCustom:
+		return ReasonLockedCustom
+	default:
+		return ReasonLocked
+	}
+}
@@ -0,0 +1,158 @@
+package contextlock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestValueOrReason(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+	const value = "value"
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		value any
+		code  string
+		ok    bool
+	}{
+		{
+			name: "missing",
+			ctx:  context.Background(),
+			code: contextlock.ReasonMissing,
+		},
+		{
+			name: "not container",
+			ctx:  context.WithValue(context.Background(), key, value),
+			code: contextlock.ReasonNotContainer,
+		},
+		{
+			name: "locked",
+			ctx:  contextlock.WithValue(context.Background(), lock{}, key, value),
+			code: contextlock.ReasonLocked,
+		},
+		{
+			name: "locked time",
+			ctx: contextlock.TimeLock(
+				contextlock.WithValue(context.Background(), lock{}, key, value),
+				lock{}, t0.Add(time.Hour), contextlock.TimeSource(nowFn),
+			),
+			code: contextlock.ReasonLockedTime,
+		},
+		{
+			name: "locked function",
+			ctx: contextlock.FunctionLock(
+				contextlock.WithValue(context.Background(), lock{}, key, value),
+				lock{}, func(ctx context.Context) bool { return false },
+			),
+			code: contextlock.ReasonLockedFunction,
+		},
+		{
+			name: "locked value",
+			ctx: contextlock.ETagLock(
+				contextlock.WithValue(context.Background(), lock{}, key, value),
+				lock{}, "etag", "v1",
+			),
+			code: contextlock.ReasonLockedValue,
+		},
+		{
+			name:  "unlocked",
+			ctx:   contextlock.WithUnlockedValue(context.Background(), lock{}, key, value),
+			value: value,
+			ok:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, code, ok := contextlock.ValueOrReason(tc.ctx, key)
+			Equal(t, tc.value, v)
+			Equal(t, tc.code, code)
+			Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestValueE(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	_, err := contextlock.ValueE(context.Background(), key)
+	True(t, errors.Is(err, contextlock.ErrNoContainer))
+
+	_, err = contextlock.ValueE(context.WithValue(context.Background(), key, "value"), key)
+	True(t, errors.Is(err, contextlock.ErrNoContainer))
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+	_, err = contextlock.ValueE(ctx, key)
+	True(t, errors.Is(err, contextlock.ErrLocked))
+
+	v, err := contextlock.ValueE(contextlock.Unlock(ctx, lock{}), key)
+	Nil(t, err)
+	Equal(t, any("value"), v)
+}
+
+func TestValueState(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		value any
+		state contextlock.State
+	}{
+		{
+			name:  "absent",
+			ctx:   context.Background(),
+			state: contextlock.StateAbsent,
+		},
+		{
+			name:  "not container",
+			ctx:   context.WithValue(context.Background(), key, "value"),
+			value: "value",
+			state: contextlock.StateNotContainer,
+		},
+		{
+			name:  "locked",
+			ctx:   contextlock.WithValue(context.Background(), lock{}, key, "value"),
+			state: contextlock.StateLocked,
+		},
+		{
+			name:  "unlocked",
+			ctx:   contextlock.WithUnlockedValue(context.Background(), lock{}, key, "value"),
+			value: "value",
+			state: contextlock.StateUnlocked,
+		},
+		{
+			name:  "tiered locked",
+			ctx:   contextlock.WithTieredValue(context.Background(), lock{}, key, "full", "limited"),
+			value: "limited",
+			state: contextlock.StateLocked,
+		},
+		{
+			name:  "tiered unlocked",
+			ctx:   contextlock.Unlock(contextlock.WithTieredValue(context.Background(), lock{}, key, "full", "limited"), lock{}),
+			value: "full",
+			state: contextlock.StateUnlocked,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, state := contextlock.ValueState(tc.ctx, key)
+			Equal(t, tc.value, value)
+			Equal(t, tc.state, state)
+		})
+	}
+
+	Equal(t, "not_container", contextlock.StateNotContainer.String())
+}
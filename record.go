@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Event is a single lock evaluation captured by a [Recorder].
+type Event struct {
+	// Key is the lock key that was evaluated.
+	Key any
+	// Time is when the evaluation finished, see [WithRecorder].
+	Time time.Time
+	// Unlocked is the result of the evaluation.
+	Unlocked bool
+}
+
+// A Recorder captures every call to [Unlocked] for contexts derived
+// from a context returned by [WithRecorder]. The zero value is ready
+// to use and a Recorder is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// WithRecorder returns a copy of parent where every lock evaluation,
+// including nested evaluations, is recorded in rec. It's registered
+// as an access hook, see [AddAccessHook].
+//
+// This is meant for reproducing authorization bugs, where the recorded
+// sequence of evaluations can be inspected with [Recorder.Events] or
+// run again with [Recorder.Replay]. The time of each event is read from
+// the time source, which can be overridden with the [TimeSource]
+// option, or with [WithClock] or [WithTimeSource] on parent.
+func WithRecorder(parent context.Context, rec *Recorder, opts ...TimestampOption) context.Context {
+	ts := newTimestamp(parent, time.Time{}, opts)
+	return AddAccessHook(parent, func(lockKey any, unlocked bool) {
+		rec.record(lockKey, unlocked, ts.now(parent))
+	})
+}
+
+// Events returns a copy of the events recorded so far, in the order
+// the evaluations finished.
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Replay evaluates the lock keys of the recorded events against ctx in
+// the order they were recorded and returns the new results.
+//
+// Comparing the result of Replay with [Recorder.Events] shows where the
+// evaluations against a reconstructed context differ from the
+// original ones. If ctx has a recorder, the replayed evaluations are
+// recorded to it as well. The time of the replayed events is read like
+// for [WithRecorder], with ctx as the parent.
+func (r *Recorder) Replay(ctx context.Context, opts ...TimestampOption) []Event {
+	ts := newTimestamp(ctx, time.Time{}, opts)
+	recorded := r.Events()
+	replayed := make([]Event, 0, len(recorded))
+	for _, e := range recorded {
+		unlocked := Unlocked(ctx, e.Key)
+		replayed = append(replayed, Event{
+			Key:      e.Key,
+			Time:     ts.now(ctx),
+			Unlocked: unlocked,
+		})
+	}
+	return replayed
+}
+
+func (r *Recorder) record(lockKey any, unlocked bool, at time.Time) {
+	e := Event{Key: lockKey, Time: at, Unlocked: unlocked}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+type evalCountersKey struct{}
+
+type evalCounterKey struct{}
+
+// WithEvalCounter returns a copy of parent where *counter is
+// incremented atomically every time the predicate of the lock behind
+// lockKey is called, for asserting how often a lock is evaluated in
+// tests.
+//
+// The predicate is the function of a [FunctionLock] or
+// [ErrFunctionLock], or the [Unlocker] of a [CustomLock]. Evaluations
+// which don't reach the predicate, such as when the result is cached,
+// aren't counted. Other types of locks are never counted. Counters are
+// added to the ones already set on parent, and a counter for the same
+// lockKey replaces the previous one.
+func WithEvalCounter(parent context.Context, lockKey any, counter *int64) context.Context {
+	existing, _ := parent.Value(evalCountersKey{}).(map[any]*int64)
+	counters := make(map[any]*int64, len(existing)+1)
+	for k, c := range existing {
+		counters[k] = c
+	}
+	counters[lockKey] = counter
+	return context.WithValue(parent, evalCountersKey{}, counters)
+}
+
+// withEvalCounter returns a copy of ctx for evaluating the lock behind
+// lockKey, where the counter for lockKey is used by [countEval]. If
+// ctx has no counters, ctx is returned as is.
+func withEvalCounter(ctx context.Context, lockKey any) context.Context {
+	counters, ok := ctx.Value(evalCountersKey{}).(map[any]*int64)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, evalCounterKey{}, counters[lockKey])
+}
+
+// countEval increments the counter for the lock being evaluated in ctx,
+// if there is one. It must be called before calling the predicate of a
+// lock.
+func countEval(ctx context.Context) {
+	if counter, _ := ctx.Value(evalCounterKey{}).(*int64); counter != nil {
+		atomic.AddInt64(counter, 1)
+	}
+}
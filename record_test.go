@@ -0,0 +1,115 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+type recorded struct {
+	Key      any
+	Unlocked bool
+}
+
+func withoutTime(events []contextlock.Event) []recorded {
+	r := make([]recorded, 0, len(events))
+	for _, e := range events {
+		r = append(r, recorded{Key: e.Key, Unlocked: e.Unlocked})
+	}
+	return r
+}
+
+func TestRecorder(t *testing.T) {
+	rec := &contextlock.Recorder{}
+
+	ctx := contextlock.WithRecorder(context.Background(), rec)
+	ctx = contextlock.Unlock(ctx, "reader")
+	ctx = contextlock.FunctionLock(ctx, "editor", func(ctx context.Context) bool {
+		return contextlock.Unlocked(ctx, "reader") && contextlock.Unlocked(ctx, "writer")
+	})
+
+	contextlock.Unlocked(ctx, "reader")
+	contextlock.Unlocked(ctx, "editor")
+	contextlock.Unlocked(ctx, "admin")
+
+	expected := []recorded{
+		{"reader", true},
+		{"reader", true},
+		{"writer", false},
+		{"editor", false},
+		{"admin", false},
+	}
+	events := rec.Events()
+	Equal(t, expected, withoutTime(events))
+	for i := 1; i < len(events); i++ {
+		False(t, events[i].Time.Before(events[i-1].Time))
+	}
+
+	// replaying against a context where writer is unlocked changes the
+	// outcome for the writer and editor locks.
+	replayed := rec.Replay(contextlock.Unlock(ctx, "writer"))
+	Equal(t, []recorded{
+		{"reader", true},
+		{"reader", true},
+		{"writer", true},
+		{"editor", true},
+		{"admin", false},
+	}, withoutTime(replayed))
+}
+
+func TestRecorderClock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+
+	clock := &contextlock.SimClock{}
+	clock.Set(t0)
+
+	rec := &contextlock.Recorder{}
+	ctx := contextlock.WithRecorder(contextlock.WithClock(context.Background(), clock), rec)
+	ctx = contextlock.Unlock(ctx, "reader")
+	contextlock.Unlocked(ctx, "reader")
+	clock.Advance(time.Minute)
+	contextlock.Unlocked(ctx, "writer")
+
+	events := rec.Events()
+	Equal(t, 2, len(events))
+	Equal(t, t0, events[0].Time)
+	Equal(t, t0.Add(time.Minute), events[1].Time)
+
+	replayed := rec.Replay(ctx)
+	Equal(t, t0.Add(time.Minute), replayed[0].Time)
+
+	explicit := rec.Replay(ctx, contextlock.TimeSource(func() time.Time { return t0 }))
+	Equal(t, t0, explicit[1].Time)
+}
+
+func TestWithEvalCounter(t *testing.T) {
+	type lock struct{}
+	type other struct{}
+
+	var count, otherCount int64
+	ctx := contextlock.FunctionLock(context.Background(), lock{}, func(ctx context.Context) bool {
+		return contextlock.Unlocked(ctx, other{})
+	})
+	ctx = contextlock.FunctionLock(ctx, other{}, func(ctx context.Context) bool {
+		return true
+	})
+	ctx = contextlock.WithEvalCounter(ctx, lock{}, &count)
+
+	for i := 0; i < 3; i++ {
+		True(t, contextlock.Unlocked(ctx, lock{}))
+	}
+	Equal(t, int64(3), count)
+
+	// nested locks are only counted by their own counter.
+	ctx = contextlock.WithEvalCounter(ctx, other{}, &otherCount)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	True(t, contextlock.Unlocked(ctx, other{}))
+	Equal(t, int64(4), count)
+	Equal(t, int64(2), otherCount)
+
+	// locks without a predicate aren't counted.
+	True(t, contextlock.Unlocked(contextlock.Unlock(ctx, lock{}), lock{}))
+	Equal(t, int64(4), count)
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counted is the lock value stored by [CountLock].
+type counted struct {
+	Limit int64
+	Count *atomic.Int64
+}
+
+// firstSeen is the lock value stored by [FirstSeenLock].
+type firstSeen struct {
+	Store interface{ SeenFirst(key string) bool }
+	IDKey any
+}
+
+// rateLimited is the lock value stored by [RateLimitLock].
+type rateLimited struct {
+	timestamp
+	Interval time.Duration
+	State    *rateState
+}
+
+// rateState is the time of the last unlock of a [RateLimitLock], shared
+// by every context the lock is in.
+type rateState struct {
+	mu       sync.Mutex
+	last     time.Time
+	unlocked bool
+}
+
+// scoped is the lock value stored by [UnlockScope].
+type scoped struct {
+	Ended *atomic.Bool
+}
+
+// once is the lock value stored by [OnceLock].
+type once struct {
+	Used *atomic.Bool
+}
+
+// CountLock returns a copy of parent where the lock is unlocked for the
+// first n evaluations and locked for every evaluation after that.
+//
+// Every call to [Unlocked] for the lock counts as an evaluation,
+// including the call made by [Value]. The count is shared by every
+// context derived from the returned context, since they all reference
+// the same lock, and it's safe to evaluate the lock from multiple
+// goroutines.
+func CountLock(parent context.Context, lockKey any, n int) context.Context {
+	return withLock(parent, lockKey, counted{
+		Limit: int64(n),
+		Count: &atomic.Int64{},
+	})
+}
+
+func (c counted) unlocked() bool {
+	return c.Count.Add(1) <= c.Limit
+}
+
+// FirstSeenLock returns a copy of parent where the lock is unlocked the
+// first time it's evaluated for the id stored as a string under idKey
+// in the evaluated context, as reported by seenStore.
+//
+// This is meant for idempotent endpoints, where a value should only be
+// available for the first request with a given idempotency key. The
+// store decides whether it has seen the id before, and is typically
+// backed by a shared cache so that ids are remembered across processes.
+// SeenFirst is called on every evaluation, including for the call made
+// by [Value], and should record the id. The lock is locked if the id is
+// missing or isn't a string.
+func FirstSeenLock(parent context.Context, lockKey any, seenStore interface{ SeenFirst(key string) bool }, idKey any) context.Context {
+	return withLock(parent, lockKey, firstSeen{
+		Store: seenStore,
+		IDKey: idKey,
+	})
+}
+
+func (f firstSeen) unlocked(ctx context.Context) bool {
+	id, ok := ctx.Value(f.IDKey).(string)
+	return ok && f.Store.SeenFirst(id)
+}
+
+// RateLimitLock returns a copy of parent where the lock is unlocked at
+// most once per interval.
+//
+// An evaluation of the lock is unlocked if it's the first, or if at
+// least interval has passed since the last evaluation which was
+// unlocked. Every call to [Unlocked] for the lock counts as an
+// evaluation, including the call made by [Value]. The time of the last
+// unlock is shared by every context derived from the returned context,
+// and it's safe to evaluate the lock from multiple goroutines. It
+// accepts the same options as [TimeLock].
+func RateLimitLock(parent context.Context, lockKey any, interval time.Duration, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, rateLimited{
+		timestamp: newTimestamp(parent, time.Time{}, opts),
+		Interval:  interval,
+		State:     &rateState{},
+	})
+}
+
+func (r rateLimited) unlocked(ctx context.Context) bool {
+	now := r.now(ctx)
+
+	r.State.mu.Lock()
+	defer r.State.mu.Unlock()
+	if r.State.unlocked && now.Sub(r.State.last) < r.Interval {
+		return false
+	}
+
+	r.State.last = now
+	r.State.unlocked = true
+	return true
+}
+
+// UnlockScope returns a copy of parent where the lock behind lockKey is
+// unlocked until the returned function is called, in the style of a
+// deferred cleanup.
+//
+// Calling the function locks the lock in the returned context and every
+// context derived from it, including contexts which have already been
+// passed on, so values guarded by the lock are inaccessible once the
+// scope has ended. Calling it more than once does nothing. The lock can
+// still be replaced in derived contexts with [Lock] and [Unlock].
+func UnlockScope(parent context.Context, lockKey any) (context.Context, func()) {
+	s := scoped{Ended: &atomic.Bool{}}
+	return withLock(parent, lockKey, s), func() { s.Ended.Store(true) }
+}
+
+// OnceLock returns a copy of parent where the lock is unlocked for the
+// first evaluation and locked for every evaluation after that.
+//
+// The evaluation is consumed by the first call to [Unlocked] for the
+// lock, and since [Value] calls Unlocked, by the first read of a value
+// guarded by the lock. Checking the lock with Unlocked before reading
+// the value therefore consumes it, and the read is locked. Like
+// [CountLock] with n set to 1, the state is shared by every context
+// derived from the returned context and it's safe to evaluate the lock
+// from multiple goroutines.
+func OnceLock(parent context.Context, lockKey any) context.Context {
+	return withLock(parent, lockKey, once{Used: &atomic.Bool{}})
+}
@@ -0,0 +1,136 @@
+package contextlock_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestCountLock(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.CountLock(context.Background(), lock{}, 2)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	// derived contexts share the count.
+	derived := context.WithValue(ctx, "unrelated", true)
+	True(t, contextlock.Unlocked(derived, lock{}))
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	False(t, contextlock.Unlocked(derived, lock{}))
+}
+
+func TestCountLockConcurrent(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.CountLock(context.Background(), lock{}, 10)
+
+	var unlocked atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if contextlock.Unlocked(ctx, lock{}) {
+				unlocked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	Equal(t, int64(10), unlocked.Load())
+}
+
+// seenStore is an in-memory store for FirstSeenLock.
+type seenStore map[string]bool
+
+func (s seenStore) SeenFirst(key string) bool {
+	if s[key] {
+		return false
+	}
+	s[key] = true
+	return true
+}
+
+func TestFirstSeenLock(t *testing.T) {
+	type lock struct{}
+	type idempotencyKey struct{}
+
+	ctx := contextlock.FirstSeenLock(context.Background(), lock{}, seenStore{}, idempotencyKey{})
+	Equal(t, contextlock.KindStateful, contextlock.LockKind(ctx, lock{}))
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	first := context.WithValue(ctx, idempotencyKey{}, "a")
+	True(t, contextlock.Unlocked(first, lock{}))
+	False(t, contextlock.Unlocked(first, lock{}))
+
+	second := context.WithValue(ctx, idempotencyKey{}, "b")
+	True(t, contextlock.Unlocked(second, lock{}))
+	False(t, contextlock.Unlocked(context.WithValue(ctx, idempotencyKey{}, "a"), lock{}))
+}
+
+func TestRateLimitLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+	ctx = contextlock.RateLimitLock(ctx, lock{}, time.Minute, contextlock.TimeSource(nowFn))
+	Equal(t, contextlock.KindStateful, contextlock.LockKind(ctx, lock{}))
+
+	_, ok := contextlock.Value(ctx, key)
+	True(t, ok)
+	_, ok = contextlock.Value(context.WithValue(ctx, "derived", true), key)
+	False(t, ok)
+
+	tNow = t0.Add(time.Minute - time.Nanosecond)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	tNow = t0.Add(time.Minute)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+func TestUnlockScope(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+	ctx, end := contextlock.UnlockScope(ctx, lock{})
+	derived := context.WithValue(ctx, "request", 1)
+
+	v, ok := contextlock.Value(derived, key)
+	True(t, ok)
+	Equal(t, any("value"), v)
+
+	end()
+	end()
+
+	v, ok = contextlock.Value(derived, key)
+	False(t, ok)
+	Nil(t, v)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+func TestOnceLock(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithValue(context.Background(), lock{}, key, "value")
+	ctx = contextlock.OnceLock(ctx, lock{})
+
+	v, ok := contextlock.Value(ctx, key)
+	True(t, ok)
+	Equal(t, any("value"), v)
+
+	v, ok = contextlock.Value(context.WithValue(ctx, "derived", true), key)
+	False(t, ok)
+	Nil(t, v)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockStatus works like [Unlocked] but also returns a human-readable
+// reason for the result, for debugging why a lock is locked.
+//
+// The reason starts with the type of lock, such as "time lock: unlocks
+// at 2024-01-01T00:00:00Z" or "function lock returned false", and is
+// "no lock registered" for a lock key without a lock. Reasons for locks
+// depending on other locks, such as [AndLock] and [NamedQuorumLock],
+// mention the lock keys formatted with %v or the member names which
+// decided the result, and the reason for an [ErrFunctionLock] includes
+// the error. The reasons are stable and can be asserted on in tests,
+// but are not meant to be parsed or shown to end users, see
+// [ValueOrReason] for stable reason codes.
+//
+// The lock is evaluated once, like a call to [Trace].
+func LockStatus(ctx context.Context, lockKey any) (unlocked bool, reason string) {
+	t := &tracer{}
+	slot := &lockErr{}
+	e := &evaluation{}
+	traced := context.WithValue(ctx, traceKey{}, t)
+	traced = context.WithValue(traced, lockErrKey{}, slot)
+	traced = context.WithValue(traced, evaluationKey{}, e)
+	unlocked = Unlocked(traced, lockKey)
+
+	if until, expired := expiredDeadline(ctx); expired {
+		return false, "global unlock deadline passed at " + formatTime(until)
+	}
+	if allowed, ok := ctx.Value(allowlistKey{}).(allowlist); ok {
+		if _, ok := allowed[lockKey]; !ok {
+			return false, "not allowed by OnlyUnlock"
+		}
+	}
+	if e.tripped.Load() {
+		return false, "nested evaluation exceeded the maximum depth or found a cycle"
+	}
+
+	t.mu.Lock()
+	members := nestedEntries(t.entries)
+	t.mu.Unlock()
+	slot.mu.Lock()
+	err := slot.err
+	slot.mu.Unlock()
+
+	if unlocked {
+		for _, g := range lockGroups(ctx, lockKey) {
+			if e, ok := lastEntry(members, g); ok && e.Unlocked {
+				return true, fmt.Sprintf("group %v is unlocked", g)
+			}
+		}
+	}
+
+	s := status{unlocked: unlocked, members: members, err: err}
+	return unlocked, s.reason(ctx, lockValue(ctx, lockKey))
+}
+
+// status is the result of evaluating a lock for [LockStatus].
+type status struct {
+	unlocked bool
+	// members are the trace entries for the locks evaluated directly
+	// by the lock.
+	members []TraceEntry
+	err     error
+}
+
+// nestedEntries returns the entries which are nested directly below
+// the first entry.
+func nestedEntries(entries []TraceEntry) []TraceEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var nested []TraceEntry
+	for _, e := range entries[1:] {
+		if e.Depth == entries[0].Depth+1 {
+			nested = append(nested, e)
+		}
+	}
+	return nested
+}
+
+// lastEntry returns the last of entries for lockKey.
+func lastEntry(entries []TraceEntry, lockKey any) (TraceEntry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Key == lockKey {
+			return entries[i], true
+		}
+	}
+	return TraceEntry{}, false
+}
+
+// reason returns the reason for the result of evaluating the lock value
+// val in ctx.
+func (s status) reason(ctx context.Context, val any) string {
+	switch val := val.(type) {
+	case nil:
+		return "no lock registered"
+	case bool:
+		return s.choose("bool lock: unlocked", "bool lock: locked")
+	case always:
+		return s.choose("always unlocked", "always locked")
+	case precomputed:
+		return s.choose("precomputed lock: unlocked", "precomputed lock: locked")
+	case timestamp:
+		return s.choose(
+			"time lock: unlocked at "+formatTime(val.Time),
+			"time lock: unlocks at "+formatTime(val.Time),
+		)
+	case window:
+		if s.unlocked {
+			return "time window lock: unlocked until " + formatTime(val.End)
+		}
+		if val.now(ctx).Before(val.Time) {
+			return "time window lock: unlocks at " + formatTime(val.Time)
+		}
+		return "time window lock: locked at " + formatTime(val.End)
+	case deadline:
+		d, ok := ctx.Deadline()
+		if !ok {
+			return "deadline lock: no deadline"
+		}
+		return s.choose(
+			"deadline lock: unlocked until "+formatTime(d),
+			"deadline lock: locked at "+formatTime(d),
+		)
+	case freshness:
+		return s.choose(
+			"freshness lock: updated within "+val.MaxAge.String(),
+			"freshness lock: not updated within "+val.MaxAge.String(),
+		)
+	case jittered:
+		id := ctx.Value(val.IDKey)
+		if id == nil {
+			return "jittered time lock: no id"
+		}
+		return s.choose(
+			"jittered time lock: unlocked at "+formatTime(val.releaseAt(id)),
+			"jittered time lock: unlocks at "+formatTime(val.releaseAt(id)),
+		)
+	case grant:
+		return s.choose("grant lock: grant is valid", "grant lock: grant is missing or invalid")
+	case condition:
+		return s.choose("value lock: condition met", "value lock: condition not met")
+	case equals:
+		return s.choose("value equals lock: value matches", "value equals lock: value doesn't match")
+	case match:
+		return s.choose("match lock: values match", "match lock: values don't match")
+	case before:
+		return s.choose("before lock: times are in order", "before lock: times are missing or out of order")
+	case sdkFlag:
+		return s.choose(
+			fmt.Sprintf("sdk flag lock: client supports %q", val.Flag),
+			fmt.Sprintf("sdk flag lock: client doesn't support %q", val.Flag),
+		)
+	case hasDeadline:
+		return s.choose("has deadline lock: context has a deadline", "has deadline lock: context has no deadline")
+	case healthy:
+		return s.choose("healthy lock: checker is healthy", "healthy lock: checker is missing or unhealthy")
+	case trusted:
+		return s.choose("trusted lock: context has a trust root", "trusted lock: context has no trust root")
+	case counted:
+		if s.unlocked {
+			return fmt.Sprintf("count lock: evaluation %d of %d", val.Count.Load(), val.Limit)
+		}
+		return fmt.Sprintf("count lock: all %d evaluations used", val.Limit)
+	case firstSeen:
+		return s.choose("first seen lock: id seen for the first time", "first seen lock: id is missing or has been seen before")
+	case rateLimited:
+		return s.choose(
+			"rate limit lock: unlocked once per "+val.Interval.String(),
+			"rate limit lock: already unlocked within "+val.Interval.String(),
+		)
+	case scoped:
+		return s.choose("scope lock: scope is active", "scope lock: scope has ended")
+	case once:
+		return s.choose("once lock: first evaluation", "once lock: already used")
+	case exclusive:
+		if len(val) > 0 && len(s.members) == 0 {
+			return "exclusive lock: maximum depth exceeded"
+		}
+		if e, ok := s.first(true); ok {
+			return fmt.Sprintf("exclusive lock: %v is unlocked", e.Key)
+		}
+		return "exclusive lock: no other lock is unlocked"
+	case all:
+		if len(val) == 0 {
+			return "and lock: no locks"
+		}
+		if len(s.members) == 0 {
+			return "and lock: maximum depth exceeded"
+		}
+		if e, ok := s.first(false); ok {
+			return fmt.Sprintf("and lock: %v is locked", e.Key)
+		}
+		return "and lock: all locks are unlocked"
+	case anyOf:
+		if len(val) == 0 {
+			return "or lock: no locks"
+		}
+		if len(s.members) == 0 {
+			return "or lock: maximum depth exceeded"
+		}
+		if e, ok := s.first(true); ok {
+			return fmt.Sprintf("or lock: %v is unlocked", e.Key)
+		}
+		return "or lock: no lock is unlocked"
+	case namedQuorum:
+		if val.Threshold < 1 {
+			return "quorum lock: threshold is less than 1"
+		}
+		if len(val.Keys) > 0 && len(s.members) == 0 {
+			return "quorum lock: maximum depth exceeded"
+		}
+		var count int
+		states := make([]string, len(s.members))
+		for i, e := range s.members {
+			if e.Unlocked {
+				count++
+			}
+			states[i] = fmt.Sprintf("%s: %s", e.Name, stateName(e.Unlocked))
+		}
+		return fmt.Sprintf("quorum lock: %d of %d unlocked, %d required (%s)", count, len(val.Keys), val.Threshold, strings.Join(states, ", "))
+	case not:
+		if len(s.members) == 0 {
+			return "not lock: maximum depth exceeded"
+		}
+		return fmt.Sprintf("not lock: %v is %s", val.Key, stateName(s.members[0].Unlocked))
+	case custom:
+		return s.choose("custom lock: unlocker returned true", "custom lock: unlocker returned false")
+	case gate:
+		return s.choose("self-gating key: Open returned true", "self-gating key: Open returned false")
+	case errLockFunction:
+		if s.err != nil && !s.unlocked {
+			return "function lock returned an error: " + s.err.Error()
+		}
+		return s.choose("function lock returned true", "function lock returned false")
+	case cachedFunction:
+		return s.choose("cached function lock returned true", "cached function lock returned false")
+	case lockFunction:
+		return s.choose("function lock returned true", "function lock returned false")
+	default:
+		return fmt.Sprintf("unknown lock of type %T", val)
+	}
+}
+
+// choose returns unlocked or locked depending on the result.
+func (s status) choose(unlocked, locked string) string {
+	if s.unlocked {
+		return unlocked
+	}
+	return locked
+}
+
+// stateName returns "unlocked" or "locked".
+func stateName(unlocked bool) string {
+	if unlocked {
+		return "unlocked"
+	}
+	return "locked"
+}
+
+// first returns the first nested lock for which the result was
+// unlocked.
+func (s status) first(unlocked bool) (TraceEntry, bool) {
+	for _, e := range s.members {
+		if e.Unlocked == unlocked {
+			return e, true
+		}
+	}
+	return TraceEntry{}, false
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
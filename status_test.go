@@ -0,0 +1,115 @@
+package contextlock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestLockStatus(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	type lock struct{}
+	const a = "reader"
+	const b = "writer"
+
+	base := contextlock.Unlock(context.Background(), a)
+	base = contextlock.Lock(base, b)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		unlocked bool
+		reason   string
+	}{
+		{
+			name:   "missing",
+			ctx:    base,
+			reason: "no lock registered",
+		},
+		{
+			name:     "bool",
+			ctx:      contextlock.Unlock(base, lock{}),
+			unlocked: true,
+			reason:   "bool lock: unlocked",
+		},
+		{
+			name:   "time",
+			ctx:    contextlock.TimeLock(base, lock{}, t0.Add(time.Hour), contextlock.TimeSource(nowFn)),
+			reason: "time lock: unlocks at 2007-08-01T16:00:00Z",
+		},
+		{
+			name:     "time unlocked",
+			ctx:      contextlock.TimeLock(base, lock{}, t0.Add(-time.Hour), contextlock.TimeSource(nowFn)),
+			unlocked: true,
+			reason:   "time lock: unlocked at 2007-08-01T14:00:00Z",
+		},
+		{
+			name:   "time window closed",
+			ctx:    contextlock.TimeWindowLock(base, lock{}, t0.Add(-2*time.Hour), t0.Add(-time.Hour), contextlock.TimeSource(nowFn)),
+			reason: "time window lock: locked at 2007-08-01T14:00:00Z",
+		},
+		{
+			name:   "deadline",
+			ctx:    contextlock.DeadlineLock(base, lock{}),
+			reason: "deadline lock: no deadline",
+		},
+		{
+			name:   "function",
+			ctx:    contextlock.FunctionLock(base, lock{}, func(ctx context.Context) bool { return false }),
+			reason: "function lock returned false",
+		},
+		{
+			name: "function error",
+			ctx: contextlock.ErrFunctionLock(base, lock{}, func(ctx context.Context) (bool, error) {
+				return false, errors.New("database unavailable")
+			}),
+			reason: "function lock returned an error: database unavailable",
+		},
+		{
+			name:   "and",
+			ctx:    contextlock.AndLock(base, lock{}, a, b),
+			reason: "and lock: writer is locked",
+		},
+		{
+			name:     "or",
+			ctx:      contextlock.OrLock(base, lock{}, b, a),
+			unlocked: true,
+			reason:   "or lock: reader is unlocked",
+		},
+		{
+			name:     "not",
+			ctx:      contextlock.NotLock(base, lock{}, b),
+			unlocked: true,
+			reason:   "not lock: writer is locked",
+		},
+		{
+			name:   "quorum",
+			ctx:    contextlock.NamedQuorumLock(base, lock{}, 2, map[string]any{"security": a, "legal": b}),
+			reason: "quorum lock: 1 of 2 unlocked, 2 required (legal: locked, security: unlocked)",
+		},
+		{
+			name:     "count",
+			ctx:      contextlock.CountLock(base, lock{}, 1),
+			unlocked: true,
+			reason:   "count lock: evaluation 1 of 1",
+		},
+		{
+			name:   "allowlist",
+			ctx:    contextlock.OnlyUnlock(contextlock.Unlock(base, lock{}), a),
+			reason: "not allowed by OnlyUnlock",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			unlocked, reason := contextlock.LockStatus(tc.ctx, lock{})
+			Equal(t, tc.unlocked, unlocked)
+			Equal(t, tc.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// freshness is the lock value stored by [FreshnessLock].
+type freshness struct {
+	timestamp
+	UpdatedKey any
+	MaxAge     time.Duration
+}
+
+// jittered is the lock value stored by [JitteredTimeLock].
+type jittered struct {
+	timestamp
+	IDKey  any
+	Jitter time.Duration
+}
+
+// window is the lock value stored by [TimeWindowLock], where Time is
+// the start of the window.
+type window struct {
+	timestamp
+	End time.Time
+}
+
+// grant is the lock value stored by [GrantLock].
+type grant struct {
+	timestamp
+	GrantKey any
+}
+
+// deadline is the lock value stored by [DeadlineLock].
+type deadline struct {
+	timestamp
+}
+
+// newTimestamp applies opts to a timestamp for t. Unless an option sets
+// a time source, the time is read from the clock set on parent, if
+// any, see [timestamp.now].
+func newTimestamp(parent context.Context, t time.Time, opts []TimestampOption) timestamp {
+	ts := timestamp{Time: t}
+	for _, o := range opts {
+		ts = o(ts)
+	}
+	if ts.TimeSource == nil {
+		if c, ok := parent.Value(clockKey{}).(Clock); ok {
+			ts.TimeSource = c.Now
+		}
+	}
+	return ts
+}
+
+type unlockedAtKey struct{}
+
+// now returns the current time for evaluating t in ctx, which is the
+// first available of:
+//
+//  1. the time passed to [UnlockedAt] if ctx is derived from a call to
+//     it,
+//  2. the time returned by t.TimeSource, which is set with the
+//     [TimeSource] option or from the [Clock] set with [WithClock] on
+//     the context the lock was added to,
+//  3. [time.Now].
+//
+// The clock of ctx itself is never consulted, so code evaluating a lock
+// can't move its time.
+func (t timestamp) now(ctx context.Context) time.Time {
+	if at, ok := ctx.Value(unlockedAtKey{}).(time.Time); ok {
+		return at
+	}
+	if t.TimeSource != nil {
+		return t.TimeSource()
+	}
+	return time.Now()
+}
+
+func (t timestamp) unlocked(ctx context.Context) bool {
+	return t.Time.Before(t.now(ctx))
+}
+
+// UnlockedAt works like [Unlocked] but evaluates the lock as if the
+// current time were at, which can be used to preview whether a lock
+// would be unlocked at some point in time.
+//
+// Time-based locks such as [TimeLock] use at instead of their time
+// source. Other locks, such as [FunctionLock], are evaluated as usual
+// and ignore at, but time-based locks evaluated as part of them use at
+// as well. The context itself isn't modified.
+func UnlockedAt(ctx context.Context, lockKey any, at time.Time) bool {
+	return Unlocked(context.WithValue(ctx, unlockedAtKey{}, at), lockKey)
+}
+
+// FreshnessLock returns a copy of parent where the lock is unlocked
+// while the [time.Time] stored under updatedKey in the evaluated
+// context is at most maxAge old.
+//
+// The age is measured against the time source, which can be overridden
+// with the [TimeSource] option. The lock is locked if there is no value
+// for updatedKey or if the value isn't a time.Time.
+func FreshnessLock(parent context.Context, lockKey any, updatedKey any, maxAge time.Duration, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, freshness{
+		timestamp:  newTimestamp(parent, time.Time{}, opts),
+		UpdatedKey: updatedKey,
+		MaxAge:     maxAge,
+	})
+}
+
+func (f freshness) unlocked(ctx context.Context) bool {
+	updated, ok := ctx.Value(f.UpdatedKey).(time.Time)
+	if !ok {
+		return false
+	}
+
+	return f.now(ctx).Sub(updated) <= f.MaxAge
+}
+
+// ClampToDeadline can be passed as a functional option to [TimeLock]
+// to move the unlock time to the deadline of ctx if the deadline is
+// earlier than the provided time.
+//
+// The deadline is read from ctx when the lock is created, so later
+// changes to the deadline of ctx do not affect the lock. If ctx has no
+// deadline, the option does nothing.
+func ClampToDeadline(ctx context.Context) TimestampOption {
+	deadline, ok := ctx.Deadline()
+	return func(t timestamp) timestamp {
+		if ok && deadline.Before(t.Time) {
+			t.Time = deadline
+		}
+		return t
+	}
+}
+
+// JitteredTimeLock returns a copy of parent where the lock will be
+// unlocked at a point in time between earliest and earliest + jitter,
+// determined by the value stored under idKey in the evaluated context.
+//
+// This spreads scheduled unlocks over a window to avoid every request
+// being released at the same instant. The offset from earliest is in
+// the range [0, jitter) and is calculated from the 64-bit FNV-1a hash
+// of the id formatted with [fmt.Sprint], so a given id is always
+// released at the same time. The lock is locked while there is no
+// value for idKey.
+func JitteredTimeLock(parent context.Context, lockKey any, earliest time.Time, jitter time.Duration, idKey any, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, jittered{
+		timestamp: newTimestamp(parent, earliest, opts),
+		IDKey:     idKey,
+		Jitter:    jitter,
+	})
+}
+
+func (j jittered) unlocked(ctx context.Context) bool {
+	id := ctx.Value(j.IDKey)
+	if id == nil {
+		return false
+	}
+
+	return j.releaseAt(id).Before(j.now(ctx))
+}
+
+// releaseAt returns the time after which the lock is unlocked for id.
+func (j jittered) releaseAt(id any) time.Time {
+	var offset time.Duration
+	if j.Jitter > 0 {
+		offset = time.Duration(hashValue(id) % uint64(j.Jitter))
+	}
+	return j.Time.Add(offset)
+}
+
+// hashValue returns the 64-bit FNV-1a hash of value formatted with
+// [fmt.Sprint].
+func hashValue(value any) uint64 {
+	h := fnv.New64a()
+	_, _ = fmt.Fprint(h, value)
+	return h.Sum64()
+}
+
+// AnyElapsedLock returns a copy of parent where the lock will be
+// unlocked as soon as the earliest of the provided points in time has
+// passed.
+//
+// It's equivalent to calling [TimeLock] with the earliest of times, and
+// accepts the same options. If times is empty, the lock is locked.
+func AnyElapsedLock(parent context.Context, lockKey any, times []time.Time, opts ...TimestampOption) context.Context {
+	if len(times) == 0 {
+		return Lock(parent, lockKey)
+	}
+
+	earliest := times[0]
+	for _, t := range times[1:] {
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return TimeLock(parent, lockKey, earliest, opts...)
+}
+
+// WhenOption returns opt if cond is true and an option which does
+// nothing otherwise, for building the options to a [TimeLock] without
+// branching.
+func WhenOption(cond bool, opt TimestampOption) TimestampOption {
+	if !cond {
+		return func(t timestamp) timestamp { return t }
+	}
+	return opt
+}
+
+// GrantLock returns a copy of parent where the lock is unlocked while
+// the grant stored under grantKey in the evaluated context is valid.
+//
+// The grant must implement
+//
+//	Valid(now time.Time) bool
+//
+// and is typically a signed, time-limited token whose signature has
+// been verified by middleware, leaving the expiry to be checked here.
+// Valid is called with the current time from the time source, which
+// can be overridden with the [TimeSource] option. The lock is locked if
+// the grant is missing or doesn't implement the method.
+func GrantLock(parent context.Context, lockKey any, grantKey any, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, grant{
+		timestamp: newTimestamp(parent, time.Time{}, opts),
+		GrantKey:  grantKey,
+	})
+}
+
+func (g grant) unlocked(ctx context.Context) bool {
+	v, ok := ctx.Value(g.GrantKey).(interface{ Valid(now time.Time) bool })
+	return ok && v.Valid(g.now(ctx))
+}
+
+// TimeWindowLock returns a copy of parent where the lock is unlocked
+// from start until end, in the half-open range [start, end), and
+// locked before and after.
+//
+// It accepts the same options as [TimeLock]. If end isn't after start,
+// the lock is always locked.
+func TimeWindowLock(parent context.Context, lockKey any, start, end time.Time, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, window{
+		timestamp: newTimestamp(parent, start, opts),
+		End:       end,
+	})
+}
+
+// TemporaryTimeLock returns a copy of parent where the lock is unlocked
+// at t and locked again once d has passed, in the half-open range
+// [t, t+d).
+//
+// It's equivalent to calling [TimeWindowLock] with t and t.Add(d), and
+// accepts the same options as [TimeLock]. If d isn't positive, the lock
+// is always locked.
+func TemporaryTimeLock(parent context.Context, lockKey any, t time.Time, d time.Duration, opts ...TimestampOption) context.Context {
+	return TimeWindowLock(parent, lockKey, t, t.Add(d), opts...)
+}
+
+// UnlockFor returns a copy of parent where the lock is unlocked from
+// now until d has passed, for relative grants such as "for the next 5
+// minutes".
+//
+// The current time is read when the lock is created, from the
+// [TimeSource] option if it's set, or else from the clock set on parent
+// with [WithClock] or [WithTimeSource], or else [time.Now]. The same
+// time source is used when evaluating the lock, like for a
+// [TimeWindowLock] from now to now plus d. If d isn't positive, the lock
+// is always locked.
+func UnlockFor(parent context.Context, lockKey any, d time.Duration, opts ...TimestampOption) context.Context {
+	ts := newTimestamp(parent, time.Time{}, opts)
+	ts.Time = ts.now(parent)
+	return withLock(parent, lockKey, window{
+		timestamp: ts,
+		End:       ts.Time.Add(d),
+	})
+}
+
+func (w window) unlocked(ctx context.Context) bool {
+	now := w.now(ctx)
+	return !now.Before(w.Time) && now.Before(w.End)
+}
+
+// DeadlineLock returns a copy of parent where the lock is unlocked
+// while the deadline of the evaluated context hasn't passed, and locked
+// once it has.
+//
+// The deadline is read from the context passed to [Unlocked], so a
+// shorter deadline on a derived context applies to the lock. The lock
+// is locked if the evaluated context has no deadline. It accepts the
+// same options as [TimeLock].
+func DeadlineLock(parent context.Context, lockKey any, opts ...TimestampOption) context.Context {
+	return withLock(parent, lockKey, deadline{
+		timestamp: newTimestamp(parent, time.Time{}, opts),
+	})
+}
+
+func (d deadline) unlocked(ctx context.Context) bool {
+	t, ok := ctx.Deadline()
+	return ok && d.now(ctx).Before(t)
+}
+
+type globalDeadlinesKey struct{}
+
+// WithGlobalUnlockDeadline returns a copy of parent where every lock is
+// locked once until has passed, in the returned context and every
+// context derived from it.
+//
+// The deadline takes precedence over the state of the individual
+// locks, so locks which are unlocked, including locks set with [Unlock]
+// after the deadline was set, are locked from until and onwards. Before
+// until, locks are evaluated as usual. Deadlines are added to the ones
+// already set on parent, so a derived context can't postpone a
+// deadline. It accepts the same options as [TimeLock].
+func WithGlobalUnlockDeadline(parent context.Context, until time.Time, opts ...TimestampOption) context.Context {
+	existing := globalDeadlines(parent)
+	deadlines := make([]timestamp, 0, len(existing)+1)
+	deadlines = append(deadlines, existing...)
+	deadlines = append(deadlines, newTimestamp(parent, until, opts))
+	return context.WithValue(parent, globalDeadlinesKey{}, deadlines)
+}
+
+// globalDeadlines returns the deadlines set with
+// [WithGlobalUnlockDeadline] on ctx.
+func globalDeadlines(ctx context.Context) []timestamp {
+	deadlines, _ := ctx.Value(globalDeadlinesKey{}).([]timestamp)
+	return deadlines
+}
+
+// expiredDeadline returns the first global deadline in ctx which has
+// passed.
+func expiredDeadline(ctx context.Context) (time.Time, bool) {
+	for _, d := range globalDeadlines(ctx) {
+		if !d.now(ctx).Before(d.Time) {
+			return d.Time, true
+		}
+	}
+	return time.Time{}, false
+}
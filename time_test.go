@@ -0,0 +1,409 @@
+package contextlock_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestFreshnessLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	type lock struct{}
+	type updated struct{}
+
+	tests := []struct {
+		name     string
+		parent   context.Context
+		unlocked bool
+	}{
+		{
+			name:     "fresh",
+			parent:   context.WithValue(context.Background(), updated{}, t0.Add(-time.Minute)),
+			unlocked: true,
+		},
+		{
+			name:     "exactly max age",
+			parent:   context.WithValue(context.Background(), updated{}, t0.Add(-time.Hour)),
+			unlocked: true,
+		},
+		{
+			name:     "stale",
+			parent:   context.WithValue(context.Background(), updated{}, t0.Add(-time.Hour-time.Nanosecond)),
+			unlocked: false,
+		},
+		{
+			name:     "missing",
+			parent:   context.Background(),
+			unlocked: false,
+		},
+		{
+			name:     "not a time",
+			parent:   context.WithValue(context.Background(), updated{}, "yesterday"),
+			unlocked: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contextlock.FreshnessLock(tc.parent, lock{}, updated{}, time.Hour, contextlock.TimeSource(nowFn))
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestClampToDeadline(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		now      time.Time
+		unlocked bool
+	}{
+		{"earlier deadline before deadline", t0.Add(time.Minute), t0, false},
+		{"earlier deadline after deadline", t0.Add(time.Minute), t0.Add(time.Minute + time.Nanosecond), true},
+		{"later deadline before target", t0.Add(2 * time.Hour), t0.Add(time.Minute + time.Nanosecond), false},
+		{"later deadline after target", t0.Add(2 * time.Hour), t0.Add(time.Hour + time.Nanosecond), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deadlineCtx, cancel := context.WithDeadline(context.Background(), tc.deadline)
+			defer cancel()
+
+			ctx := contextlock.TimeLock(
+				context.Background(),
+				lock{},
+				t0.Add(time.Hour),
+				contextlock.TimeSource(nowFn),
+				contextlock.ClampToDeadline(deadlineCtx),
+			)
+
+			tNow = tc.now
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+
+	t.Run("no deadline", func(t *testing.T) {
+		ctx := contextlock.TimeLock(
+			context.Background(),
+			lock{},
+			t0.Add(time.Hour),
+			contextlock.TimeSource(nowFn),
+			contextlock.ClampToDeadline(context.Background()),
+		)
+
+		tNow = t0.Add(time.Hour)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestJitteredTimeLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+	type id struct{}
+
+	unlocksAt := func(tenant string) time.Time {
+		ctx := context.WithValue(context.Background(), id{}, tenant)
+		ctx = contextlock.JitteredTimeLock(ctx, lock{}, t0, time.Hour, id{}, contextlock.TimeSource(nowFn))
+
+		// step through the window a second at a time to find the
+		// first unlocked instant.
+		for tNow = t0; tNow.Before(t0.Add(time.Hour + time.Second)); tNow = tNow.Add(time.Second) {
+			if contextlock.Unlocked(ctx, lock{}) {
+				return tNow
+			}
+		}
+		t.Fatalf("%s was never unlocked", tenant)
+		return time.Time{}
+	}
+
+	a := unlocksAt("tenant-a")
+	b := unlocksAt("tenant-b")
+
+	True(t, a.After(t0))
+	True(t, b.After(t0))
+	True(t, a.Before(t0.Add(time.Hour+time.Second)))
+	True(t, b.Before(t0.Add(time.Hour+time.Second)))
+	False(t, a.Equal(b))
+
+	// the same id is always released at the same time.
+	Equal(t, a, unlocksAt("tenant-a"))
+
+	t.Run("missing id", func(t *testing.T) {
+		ctx := contextlock.JitteredTimeLock(context.Background(), lock{}, t0, time.Hour, id{}, contextlock.TimeSource(nowFn))
+		tNow = t0.Add(2 * time.Hour)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestAnyElapsedLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+
+	ctx := contextlock.AnyElapsedLock(
+		context.Background(),
+		lock{},
+		[]time.Time{t0.Add(3 * time.Hour), t0.Add(time.Hour), t0.Add(2 * time.Hour)},
+		contextlock.TimeSource(nowFn),
+	)
+
+	tests := []struct {
+		testTime time.Time
+		unlocked bool
+	}{
+		{t0, false},
+		{t0.Add(time.Hour), false},
+		{t0.Add(time.Hour + time.Nanosecond), true},
+		{t0.Add(2 * time.Hour), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s = %v", tc.testTime, tc.unlocked), func(t *testing.T) {
+			tNow = tc.testTime
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+
+	t.Run("no times", func(t *testing.T) {
+		ctx := contextlock.AnyElapsedLock(context.Background(), lock{}, nil, contextlock.TimeSource(nowFn))
+		tNow = t0.Add(time.Hour * 24)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestWhenOption(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	before := func() time.Time { return t0.Add(-time.Minute) }
+	after := func() time.Time { return t0.Add(time.Minute) }
+
+	type lock struct{}
+
+	ctx := contextlock.TimeLock(context.Background(), lock{}, t0,
+		contextlock.TimeSource(before),
+		contextlock.WhenOption(true, contextlock.TimeSource(after)),
+	)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	ctx = contextlock.TimeLock(context.Background(), lock{}, t0,
+		contextlock.TimeSource(before),
+		contextlock.WhenOption(false, contextlock.TimeSource(after)),
+	)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+type fakeGrant struct {
+	expires time.Time
+}
+
+func (g fakeGrant) Valid(now time.Time) bool {
+	return now.Before(g.expires)
+}
+
+func TestGrantLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+	type grantKey struct{}
+
+	ctx := context.WithValue(context.Background(), grantKey{}, fakeGrant{expires: t0.Add(time.Hour)})
+	ctx = contextlock.GrantLock(ctx, lock{}, grantKey{}, contextlock.TimeSource(nowFn))
+
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	tNow = t0.Add(time.Hour)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	t.Run("missing", func(t *testing.T) {
+		ctx := contextlock.GrantLock(context.Background(), lock{}, grantKey{}, contextlock.TimeSource(nowFn))
+		tNow = t0
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestUnlockedAt(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	nowFn := func() time.Time { return t0 }
+
+	type lock struct{}
+	type composite struct{}
+
+	ctx := contextlock.TimeLock(context.Background(), lock{}, t0.Add(time.Hour), contextlock.TimeSource(nowFn))
+	ctx = contextlock.FunctionLock(ctx, composite{}, func(ctx context.Context) bool {
+		return contextlock.Unlocked(ctx, lock{})
+	})
+
+	False(t, contextlock.UnlockedAt(ctx, lock{}, t0))
+	False(t, contextlock.UnlockedAt(ctx, lock{}, t0.Add(time.Hour)))
+	True(t, contextlock.UnlockedAt(ctx, lock{}, t0.Add(time.Hour+time.Nanosecond)))
+	True(t, contextlock.UnlockedAt(ctx, composite{}, t0.Add(2*time.Hour)))
+
+	// the context still uses its own time source.
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	False(t, contextlock.Unlocked(ctx, composite{}))
+
+	// locks which don't depend on time ignore at.
+	ctx = contextlock.Unlock(ctx, lock{})
+	True(t, contextlock.UnlockedAt(ctx, lock{}, t0))
+}
+
+func TestTimeWindowLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+
+	ctx := contextlock.TimeWindowLock(
+		context.Background(),
+		lock{},
+		t0.Add(time.Hour),
+		t0.Add(2*time.Hour),
+		contextlock.TimeSource(nowFn),
+	)
+
+	tests := []struct {
+		testTime time.Time
+		unlocked bool
+	}{
+		{t0, false},
+		{t0.Add(time.Hour - time.Nanosecond), false},
+		{t0.Add(time.Hour), true},
+		{t0.Add(90 * time.Minute), true},
+		{t0.Add(2*time.Hour - time.Nanosecond), true},
+		{t0.Add(2 * time.Hour), false},
+		{t0.Add(3 * time.Hour), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s = %v", tc.testTime, tc.unlocked), func(t *testing.T) {
+			tNow = tc.testTime
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestDeadlineLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	clock := &contextlock.SimClock{}
+	clock.Set(t0)
+
+	type lock struct{}
+
+	ctx := contextlock.WithClock(context.Background(), clock)
+	ctx = contextlock.DeadlineLock(ctx, lock{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, contextlock.KindTime, contextlock.LockKind(ctx, lock{}))
+
+	withDeadline, cancel := context.WithDeadline(ctx, t0.Add(time.Minute))
+	defer cancel()
+	True(t, contextlock.Unlocked(withDeadline, lock{}))
+
+	clock.Advance(time.Minute)
+	False(t, contextlock.Unlocked(withDeadline, lock{}))
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	False(t, contextlock.Unlocked(contextlock.DeadlineLock(expired, lock{}), lock{}))
+}
+
+func TestTemporaryTimeLock(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+
+	ctx := contextlock.TemporaryTimeLock(context.Background(), lock{}, t0.Add(time.Hour), 10*time.Minute, contextlock.TimeSource(nowFn))
+
+	tests := []struct {
+		testTime time.Time
+		unlocked bool
+	}{
+		{t0, false},
+		{t0.Add(time.Hour), true},
+		{t0.Add(time.Hour + 10*time.Minute - time.Nanosecond), true},
+		{t0.Add(time.Hour + 10*time.Minute), false},
+		{t0.Add(2 * time.Hour), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s = %v", tc.testTime, tc.unlocked), func(t *testing.T) {
+			tNow = tc.testTime
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestWithGlobalUnlockDeadline(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	clock := &contextlock.SimClock{}
+	clock.Set(t0)
+
+	type reader struct{}
+	type writer struct{}
+
+	ctx := contextlock.WithClock(context.Background(), clock)
+	ctx = contextlock.Unlock(ctx, reader{})
+	ctx = contextlock.WithGlobalUnlockDeadline(ctx, t0.Add(time.Hour))
+	ctx = contextlock.Unlock(ctx, writer{})
+	ctx = contextlock.Lock(ctx, writer{})
+
+	True(t, contextlock.Unlocked(ctx, reader{}))
+	False(t, contextlock.Unlocked(ctx, writer{}))
+
+	// a later deadline on a derived context doesn't postpone it.
+	later := contextlock.WithGlobalUnlockDeadline(ctx, t0.Add(2*time.Hour))
+
+	clock.Advance(time.Hour)
+	False(t, contextlock.Unlocked(ctx, reader{}))
+	False(t, contextlock.Unlocked(contextlock.Unlock(ctx, writer{}), writer{}))
+	False(t, contextlock.Unlocked(later, reader{}))
+
+	unlocked, reason := contextlock.LockStatus(ctx, reader{})
+	False(t, unlocked)
+	Equal(t, "global unlock deadline passed at 2007-08-01T16:00:00Z", reason)
+}
+
+func TestUnlockFor(t *testing.T) {
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+	tNow := t0
+	nowFn := func() time.Time { return tNow }
+
+	type lock struct{}
+
+	ctx := contextlock.UnlockFor(context.Background(), lock{}, 5*time.Minute, contextlock.TimeSource(nowFn))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	tNow = t0.Add(5*time.Minute - time.Nanosecond)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	tNow = t0.Add(5 * time.Minute)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	// the creation time is read from the clock on parent.
+	clock := &contextlock.SimClock{}
+	clock.Set(t0)
+	ctx = contextlock.UnlockFor(contextlock.WithClock(context.Background(), clock), lock{}, time.Minute)
+	True(t, contextlock.Unlocked(ctx, lock{}))
+
+	clock.Advance(time.Minute)
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"sync"
+)
+
+// A TraceEntry describes the evaluation of a single lock as recorded
+// by [Trace].
+type TraceEntry struct {
+	// Key is the lock key that was evaluated.
+	Key any
+	// Name is the name of the lock within the lock depending on it,
+	// such as the member name for a [NamedQuorumLock], or empty.
+	Name string
+	// Kind is the type of lock stored for Key.
+	Kind Kind
+	// Depth is how deeply nested the evaluation was, 0 for the lock
+	// passed to Trace.
+	Depth int
+	// Unlocked is the result of the evaluation.
+	Unlocked bool
+}
+
+type traceKey struct{}
+
+type traceNameKey struct{}
+
+// traceName is the name of the lock evaluated at depth, see
+// [withTraceName].
+type traceName struct {
+	name  string
+	depth int
+}
+
+// tracer collects trace entries for a call to [Trace].
+type tracer struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+}
+
+// Trace evaluates the lock behind lockKey in ctx like [Unlocked] and
+// returns an entry for every lock that was evaluated in the process.
+//
+// The entries are listed in the order the evaluations started, so a
+// lock is followed by the locks it depends on with a greater Depth.
+// For a [FunctionLock] which calls Unlocked for other locks this yields
+// the tree of decisions that led to the result, which is helpful for
+// debugging why a lock is locked.
+func Trace(ctx context.Context, lockKey any) []TraceEntry {
+	t := &tracer{}
+	Unlocked(context.WithValue(ctx, traceKey{}, t), lockKey)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEntry(nil), t.entries...)
+}
+
+// begin adds an entry for an evaluation which is starting and returns
+// its index.
+func (t *tracer) begin(ctx context.Context, lockKey any, kind Kind) int {
+	depth, _ := ctx.Value(depthKey{}).(int)
+
+	var name string
+	if n, ok := ctx.Value(traceNameKey{}).(traceName); ok && n.depth == depth {
+		name = n.name
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, TraceEntry{
+		Key:   lockKey,
+		Name:  name,
+		Kind:  kind,
+		Depth: depth,
+	})
+	return len(t.entries) - 1
+}
+
+// end records the result for the entry at index i.
+func (t *tracer) end(i int, unlocked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[i].Unlocked = unlocked
+}
+
+// withTraceName returns a copy of ctx where the lock evaluated next is
+// named name in the trace. Locks nested below it are not named. If ctx
+// isn't being traced, ctx is returned as is.
+func withTraceName(ctx context.Context, name string) context.Context {
+	if _, ok := ctx.Value(traceKey{}).(*tracer); !ok {
+		return ctx
+	}
+
+	depth, _ := ctx.Value(depthKey{}).(int)
+	return context.WithValue(ctx, traceNameKey{}, traceName{name: name, depth: depth})
+}
@@ -0,0 +1,29 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestTrace(t *testing.T) {
+	type and struct{}
+	type role struct{}
+	type owner struct{}
+
+	ctx := contextlock.Unlock(context.Background(), role{})
+	ctx = contextlock.Lock(ctx, owner{})
+	ctx = contextlock.FunctionLock(ctx, and{}, func(ctx context.Context) bool {
+		return contextlock.Unlocked(ctx, role{}) && contextlock.Unlocked(ctx, owner{})
+	})
+
+	Equal(t, []contextlock.TraceEntry{
+		{Key: and{}, Kind: contextlock.KindFunction, Depth: 0, Unlocked: false},
+		{Key: role{}, Kind: contextlock.KindBool, Depth: 1, Unlocked: true},
+		{Key: owner{}, Kind: contextlock.KindBool, Depth: 1, Unlocked: false},
+	}, contextlock.Trace(ctx, and{}))
+
+	// tracing doesn't leak into the traced context.
+	False(t, contextlock.Unlocked(ctx, and{}))
+}
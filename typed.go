@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"fmt"
+)
+
+// A TypedContainer is a [Container] for a value of type T, added with
+// [WithTypedValue].
+//
+// It can be read with [Value] and the other functions for reading
+// containers like a Container, and [TypedContainer.Value] returns the
+// value as a T. Cannot be initialized from outside the contextlock
+// package.
+type TypedContainer[T any] struct {
+	key      lock
+	valueKey any
+	value    T
+}
+
+// String returns a placeholder for the container which doesn't include
+// the value or the lock key, see [Container.String].
+func (c TypedContainer[T]) String() string {
+	return "contextlock.TypedContainer{redacted}"
+}
+
+// GoString is like [TypedContainer.String], for the %#v verb.
+func (c TypedContainer[T]) GoString() string {
+	return c.String()
+}
+
+// Format formats the container as [TypedContainer.String] for every
+// verb.
+func (c TypedContainer[T]) Format(f fmt.State, verb rune) {
+	_, _ = fmt.Fprint(f, c.String())
+}
+
+// WithTypedValue works like [WithValue] but stores the value in a
+// [TypedContainer], for use together with [TypedValue].
+func WithTypedValue[T any](parent context.Context, lockKey, key any, value T) context.Context {
+	return withContainer(parent, key, TypedContainer[T]{
+		key:      lock(lockKey),
+		valueKey: key,
+		value:    value,
+	})
+}
+
+// Value returns the value contained in the container if and only if
+// the container's lock in ctx is unlocked, see [Container.Value].
+//
+// If the lock is locked, the zero value of T and false are returned.
+func (c TypedContainer[T]) Value(ctx context.Context) (T, bool) {
+	if _, _, granted := c.container().access(ctx); !granted {
+		var zero T
+		return zero, false
+	}
+	return c.value, true
+}
+
+func (c TypedContainer[T]) container() Container {
+	return Container{key: c.key, valueKey: c.valueKey, value: c.value}
+}
+
+func (c TypedContainer[T]) relock(lockKey any) protected {
+	c.key = lock(lockKey)
+	return c
+}
+
+// TypedValue works like [Value] but returns the value as a T.
+//
+// If the container is locked, the key doesn't hold a [Container] or a
+// [TypedContainer], or the value isn't a T, the zero value of T and
+// false are returned.
+func TypedValue[T any](ctx context.Context, key any) (T, bool) {
+	value, ok := Value(ctx, key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	v, ok := value.(T)
+	return v, ok
+}
+
+// TypedValueOr works like [TypedValue] but returns fallback instead of
+// the zero value of T when the value isn't available.
+func TypedValueOr[T any](ctx context.Context, key any, fallback T) T {
+	v, ok := TypedValue[T](ctx, key)
+	if !ok {
+		return fallback
+	}
+	return v
+}
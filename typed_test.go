@@ -0,0 +1,88 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestTypedValue(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithTypedValue(context.Background(), lock{}, key, 42)
+
+	v, ok := contextlock.TypedValue[int](ctx, key)
+	False(t, ok)
+	Equal(t, 0, v)
+
+	ctx = contextlock.Unlock(ctx, lock{})
+
+	v, ok = contextlock.TypedValue[int](ctx, key)
+	True(t, ok)
+	Equal(t, 42, v)
+
+	s, ok := contextlock.TypedValue[string](ctx, key)
+	False(t, ok)
+	Equal(t, "", s)
+
+	v, ok = contextlock.TypedValue[int](ctx, "missing")
+	False(t, ok)
+	Equal(t, 0, v)
+}
+
+func TestTypedValueOr(t *testing.T) {
+	type lock struct{}
+	const key = "key"
+
+	ctx := contextlock.WithTypedValue(context.Background(), lock{}, key, 42)
+	Equal(t, 7, contextlock.TypedValueOr(ctx, key, 7))
+	Equal(t, 7, contextlock.TypedValueOr(ctx, "missing", 7))
+
+	ctx = contextlock.Unlock(ctx, lock{})
+	Equal(t, 42, contextlock.TypedValueOr(ctx, key, 7))
+	Equal(t, "fallback", contextlock.TypedValueOr(ctx, key, "fallback"))
+}
+
+func TestTypedContainer(t *testing.T) {
+	type lock struct{}
+	type count struct{}
+	type name struct{}
+
+	ctx := contextlock.WithTypedValue(context.Background(), lock{}, count{}, 42)
+	ctx = contextlock.WithValue(ctx, lock{}, name{}, "Emil")
+
+	container, ok := ctx.Value(count{}).(contextlock.TypedContainer[int])
+	True(t, ok)
+
+	n, ok := container.Value(ctx)
+	False(t, ok)
+	Equal(t, 0, n)
+
+	ctx = contextlock.Unlock(ctx, lock{})
+
+	n, ok = container.Value(ctx)
+	True(t, ok)
+	Equal(t, 42, n)
+
+	// typed and untyped containers can be read in the same way.
+	v, ok := contextlock.Value(ctx, count{})
+	True(t, ok)
+	Equal(t, any(42), v)
+
+	v, code, ok := contextlock.ValueOrReason(ctx, name{})
+	True(t, ok)
+	Equal(t, "", code)
+	Equal(t, any("Emil"), v)
+
+	s, ok := contextlock.TypedValue[string](ctx, name{})
+	True(t, ok)
+	Equal(t, "Emil", s)
+
+	relocked := contextlock.Relock(ctx, count{}, lock{}, "other")
+	_, ok = relocked.Value(count{}).(contextlock.TypedContainer[int])
+	True(t, ok)
+	_, ok = contextlock.Value(relocked, count{})
+	False(t, ok)
+}
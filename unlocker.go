@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import "context"
+
+// An Unlocker decides whether a custom lock set with [CustomLock] is
+// unlocked.
+type Unlocker interface {
+	// Unlocked returns true if the lock is unlocked. The context
+	// passed to Unlocked is derived from the context passed to the
+	// package level [Unlocked] function.
+	Unlocked(ctx context.Context) bool
+}
+
+// custom is the lock value stored by [CustomLock].
+type custom struct {
+	Unlocker Unlocker
+}
+
+type strictUnlockersKey struct{}
+
+// CustomLock returns a copy of parent where the lock calls u to check
+// whether it's unlocked.
+//
+// If u panics, the lock is treated as locked unless the context has
+// been created with [WithStrictUnlockers].
+func CustomLock(parent context.Context, lockKey any, u Unlocker) context.Context {
+	return withLock(parent, lockKey, custom{Unlocker: u})
+}
+
+// WithStrictUnlockers returns a copy of parent where a panic in an
+// [Unlocker] or the function of a [FunctionLock] or [ErrFunctionLock]
+// propagates to the caller of [Unlocked] instead of being treated as
+// the lock being locked. The same goes for other code called by locks,
+// such as the predicate of a [ValuePredicateLock], the Valid method of
+// a grant for a [GrantLock] or a [Clock] set with [WithClock].
+//
+// This is meant for surfacing bugs in custom locks during development
+// and testing, the default of treating panics as locked is safer for
+// production use.
+func WithStrictUnlockers(parent context.Context) context.Context {
+	return context.WithValue(parent, strictUnlockersKey{}, true)
+}
+
+type panicObserverKey struct{}
+
+// WithPanicObserver returns a copy of parent where fn is called with
+// the recovered value when an [Unlocker], the function of a
+// [FunctionLock] or [ErrFunctionLock] or other code called by a lock
+// panics, see [WithStrictUnlockers], for reporting bugs in locks which
+// would otherwise just be locked.
+//
+// The observer replaces any observer set on parent, and isn't called
+// in contexts created with [WithStrictUnlockers], where the panic
+// propagates instead.
+func WithPanicObserver(parent context.Context, fn func(v any)) context.Context {
+	return context.WithValue(parent, panicObserverKey{}, fn)
+}
+
+// strictUnlockers returns true if panics in locks evaluated in ctx
+// should propagate, see [WithStrictUnlockers].
+func strictUnlockers(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictUnlockersKey{}).(bool)
+	return strict
+}
+
+// recoverLock recovers from a panic while evaluating a lock in ctx and
+// passes the value to the panic observer. It must be deferred by the
+// function evaluating the lock, which then returns false.
+func recoverLock(ctx context.Context) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	observePanic(ctx, v)
+}
+
+// observePanic passes v to the panic observer in ctx, if any.
+func observePanic(ctx context.Context, v any) {
+	if fn, ok := ctx.Value(panicObserverKey{}).(func(v any)); ok && fn != nil {
+		fn(v)
+	}
+}
+
+// valueLock is implemented by the lock values which call code outside
+// of the contextlock package, such as the function of a
+// [ValuePredicateLock] or a clock set with [WithClock].
+type valueLock interface {
+	unlocked(ctx context.Context) bool
+}
+
+// guarded evaluates val, treating a panic like a panic in an
+// [Unlocker].
+func guarded(ctx context.Context, val valueLock) bool {
+	if !strictUnlockers(ctx) {
+		defer recoverLock(ctx)
+	}
+	return val.unlocked(ctx)
+}
+
+func (c custom) unlocked(ctx context.Context) bool {
+	nested, ok := descend(ctx)
+	if !ok {
+		return false
+	}
+
+	if !strictUnlockers(ctx) {
+		defer recoverLock(ctx)
+	}
+	countEval(ctx)
+	return c.Unlocker.Unlocked(nested)
+}
+
+// WithLocks returns a copy of parent where each [Unlocker] in locks is
+// set as a [CustomLock] for its lock key, for building a policy from
+// configuration in one call.
+//
+// Since the keys of a map are distinct, the order in which the locks
+// are added doesn't affect the result. A nil Unlocker locks its lock
+// key.
+func WithLocks(parent context.Context, locks map[any]Unlocker) context.Context {
+	ctx := parent
+	for lockKey, u := range locks {
+		if u == nil {
+			ctx = Lock(ctx, lockKey)
+			continue
+		}
+		ctx = CustomLock(ctx, lockKey, u)
+	}
+	return ctx
+}
+
+type selfGatingKeysKey struct{}
+
+// gate is the lock value used for a self-gating lock key, see
+// [WithSelfGatingKeys].
+type gate struct {
+	Key opener
+}
+
+// opener is implemented by self-gating lock keys.
+type opener interface {
+	Open(ctx context.Context) bool
+}
+
+// WithSelfGatingKeys returns a copy of parent where lock keys can
+// decide whether they're unlocked themselves.
+//
+// A lock key which implements
+//
+//	Open(ctx context.Context) bool
+//
+// and doesn't have a lock set in the context is unlocked when Open
+// returns true. Locks set with [Lock], [Unlock] or any other lock
+// function take precedence over Open. Panics in Open are handled like
+// panics in an [Unlocker].
+func WithSelfGatingKeys(parent context.Context) context.Context {
+	return context.WithValue(parent, selfGatingKeysKey{}, true)
+}
+
+// selfGate returns the lock value for lockKey if it's a self-gating
+// lock key in ctx, or nil otherwise.
+func selfGate(ctx context.Context, lockKey any) any {
+	if enabled, _ := ctx.Value(selfGatingKeysKey{}).(bool); !enabled {
+		return nil
+	}
+
+	g, ok := lockKey.(interface {
+		Open(ctx context.Context) bool
+	})
+	if !ok {
+		return nil
+	}
+	return gate{Key: g}
+}
+
+func (g gate) unlocked(ctx context.Context) bool {
+	return custom{Unlocker: unlockerFunc(g.Key.Open)}.unlocked(ctx)
+}
+
+// unlockerFunc adapts a function to the [Unlocker] interface.
+type unlockerFunc func(ctx context.Context) bool
+
+func (fn unlockerFunc) Unlocked(ctx context.Context) bool {
+	return fn(ctx)
+}
@@ -0,0 +1,87 @@
+package contextlock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sakjur/contextlock"
+)
+
+type unlockerFunc func(ctx context.Context) bool
+
+func (fn unlockerFunc) Unlocked(ctx context.Context) bool {
+	return fn(ctx)
+}
+
+func TestCustomLock(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.CustomLock(context.Background(), lock{}, unlockerFunc(func(ctx context.Context) bool {
+		return true
+	}))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, contextlock.KindCustom, contextlock.LockKind(ctx, lock{}))
+
+	ctx = contextlock.CustomLock(context.Background(), lock{}, unlockerFunc(func(ctx context.Context) bool {
+		return false
+	}))
+	False(t, contextlock.Unlocked(ctx, lock{}))
+}
+
+func TestStrictUnlockers(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.CustomLock(context.Background(), lock{}, unlockerFunc(func(ctx context.Context) bool {
+		panic("oops")
+	}))
+
+	// panics are treated as locked by default.
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	defer func() {
+		Equal(t, any("oops"), recover())
+	}()
+	contextlock.Unlocked(contextlock.WithStrictUnlockers(ctx), lock{})
+	t.Fatal("expected panic")
+}
+
+func TestWithLocks(t *testing.T) {
+	type reader struct{}
+	type writer struct{}
+	type admin struct{}
+
+	ctx := contextlock.Unlock(context.Background(), admin{})
+	ctx = contextlock.WithLocks(ctx, map[any]contextlock.Unlocker{
+		reader{}: unlockerFunc(func(ctx context.Context) bool { return true }),
+		writer{}: unlockerFunc(func(ctx context.Context) bool { return contextlock.Unlocked(ctx, reader{}) }),
+		admin{}:  nil,
+	})
+
+	True(t, contextlock.Unlocked(ctx, reader{}))
+	True(t, contextlock.Unlocked(ctx, writer{}))
+	False(t, contextlock.Unlocked(ctx, admin{}))
+	Equal(t, contextlock.KindCustom, contextlock.LockKind(ctx, reader{}))
+}
+
+type gatedKey bool
+
+func (k gatedKey) Open(ctx context.Context) bool {
+	return bool(k)
+}
+
+func TestWithSelfGatingKeys(t *testing.T) {
+	open := gatedKey(true)
+	closed := gatedKey(false)
+
+	ctx := context.Background()
+	False(t, contextlock.Unlocked(ctx, open))
+
+	ctx = contextlock.WithSelfGatingKeys(ctx)
+	True(t, contextlock.Unlocked(ctx, open))
+	False(t, contextlock.Unlocked(ctx, closed))
+	Equal(t, contextlock.KindCustom, contextlock.LockKind(ctx, open))
+
+	// explicit locks take precedence over Open.
+	False(t, contextlock.Unlocked(contextlock.Lock(ctx, open), open))
+	True(t, contextlock.Unlocked(contextlock.Unlock(ctx, closed), closed))
+}
@@ -0,0 +1,591 @@
+// SPDX-License-Identifier: MIT-0
+
+package contextlock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// condition is a lock which is unlocked when Check returns true for the
+// value stored under Key in the context being evaluated.
+type condition struct {
+	Key   any
+	Check func(value any) bool
+}
+
+func (c condition) unlocked(ctx context.Context) bool {
+	return c.Check(ctx.Value(c.Key))
+}
+
+// match is the lock value stored by [MatchLock].
+type match struct {
+	KeyA any
+	KeyB any
+}
+
+// before is the lock value stored by [BeforeLock].
+type before struct {
+	EarlierKey any
+	LaterKey   any
+}
+
+// sdkFlag is the lock value stored by [SDKFlagLock].
+type sdkFlag struct {
+	ClientKey any
+	Flag      string
+}
+
+// hasDeadline is the lock value stored by [HasDeadlineLock].
+type hasDeadline struct{}
+
+// equals is the lock value stored by [ValueEqualsLock].
+type equals struct {
+	Key      any
+	Expected any
+}
+
+// trusted is the lock value stored by [TrustedLock].
+type trusted struct {
+	Root *TrustRoot
+}
+
+// trustRootKey is the key under which a context is marked with root.
+type trustRootKey struct {
+	root *TrustRoot
+}
+
+// healthy is the lock value stored by [HealthyLock].
+type healthy struct {
+	CheckerKey any
+}
+
+// ETagLock returns a copy of parent where the lock is unlocked when the
+// string stored under etagKey in the evaluated context equals want.
+//
+// This is meant for conditional access in the style of HTTP
+// conditional requests, where a value is only readable when the
+// version the client has matches the current version. The comparison
+// is an exact, case-sensitive string comparison. The lock is locked if
+// the value is missing, isn't a string, or doesn't match.
+func ETagLock(parent context.Context, lockKey any, etagKey any, want string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: etagKey,
+		Check: func(value any) bool {
+			etag, ok := value.(string)
+			return ok && etag == want
+		},
+	})
+}
+
+// RangeLock returns a copy of parent where the lock is unlocked when
+// the number stored under valueKey in the evaluated context is within
+// the inclusive range [min, max].
+//
+// Values of any integer or floating point type are accepted and
+// converted to float64 before being compared, which means that very
+// large 64-bit integers may lose precision. The lock is locked if the
+// value is missing or isn't a number.
+func RangeLock(parent context.Context, lockKey any, valueKey any, min, max float64) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: valueKey,
+		Check: func(value any) bool {
+			f, ok := toFloat64(value)
+			return ok && f >= min && f <= max
+		},
+	})
+}
+
+// toFloat64 converts any integer or floating point value to a float64.
+func toFloat64(value any) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// HasDeadlineLock returns a copy of parent where the lock is unlocked
+// only when the evaluated context has a deadline.
+//
+// This can be used to refuse unbounded work by only releasing values
+// to requests which have a set deadline. The deadline is checked on the
+// context passed to [Unlocked], so a deadline added to a context
+// derived from the returned context unlocks the lock.
+func HasDeadlineLock(parent context.Context, lockKey any) context.Context {
+	return withLock(parent, lockKey, hasDeadline{})
+}
+
+// EnvLock returns a copy of parent where the lock is unlocked when the
+// environment name stored as a string under envKey in the evaluated
+// context is one of allowed, such as "staging" or "dev".
+//
+// Environment names are compared case-insensitively, so "Prod" and
+// "PROD" both match "prod". The lock is locked if the value is missing
+// or isn't a string, and when allowed is empty.
+func EnvLock(parent context.Context, lockKey any, envKey any, allowed ...string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: envKey,
+		Check: func(value any) bool {
+			return containsFold(value, allowed)
+		},
+	})
+}
+
+// containsFold returns true if value is a string which is equal to one
+// of the strings in set when compared case-insensitively.
+func containsFold(value any, set []string) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	for _, candidate := range set {
+		if strings.EqualFold(s, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChallengeLock returns a copy of parent where the lock is unlocked when
+// the value stored under resultKey in the evaluated context reports
+// that a challenge, such as a CAPTCHA, was passed.
+//
+// The value must implement
+//
+//	Passed() bool
+//
+// and is typically set by middleware after validating the challenge.
+// The lock is locked if the value is missing, doesn't implement the
+// method, or Passed returns false.
+func ChallengeLock(parent context.Context, lockKey any, resultKey any) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: resultKey,
+		Check: func(value any) bool {
+			result, ok := value.(interface{ Passed() bool })
+			return ok && result.Passed()
+		},
+	})
+}
+
+// MatchLock returns a copy of parent where the lock is unlocked when the
+// values stored under keyA and keyB in the evaluated context are both
+// non-nil and deeply equal according to [reflect.DeepEqual].
+//
+// This can be used for double-entry verification, such as confirming
+// that a re-entered field matches the original.
+func MatchLock(parent context.Context, lockKey any, keyA, keyB any) context.Context {
+	return withLock(parent, lockKey, match{KeyA: keyA, KeyB: keyB})
+}
+
+func (m match) unlocked(ctx context.Context) bool {
+	a, b := ctx.Value(m.KeyA), ctx.Value(m.KeyB)
+	return a != nil && b != nil && reflect.DeepEqual(a, b)
+}
+
+// BucketLock returns a copy of parent where the lock is unlocked when
+// the id stored under idKey in the evaluated context hashes into
+// bucket out of totalBuckets, numbered from 0.
+//
+// The bucket of an id is the 64-bit FNV-1a hash of the id formatted
+// with [fmt.Sprint], modulo totalBuckets. The algorithm is part of the
+// API and won't change, so an id stays in the same bucket between
+// releases. The lock is locked if there is no id or if totalBuckets is
+// less than 1.
+func BucketLock(parent context.Context, lockKey any, idKey any, bucket, totalBuckets int) context.Context {
+	return BucketRangeLock(parent, lockKey, idKey, bucket, bucket+1, totalBuckets)
+}
+
+// BucketRangeLock works like [BucketLock] but unlocks the lock for ids
+// in any of the buckets in the range [from, to).
+func BucketRangeLock(parent context.Context, lockKey any, idKey any, from, to, totalBuckets int) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: idKey,
+		Check: func(value any) bool {
+			if value == nil || totalBuckets < 1 {
+				return false
+			}
+
+			b := bucketOf(value, totalBuckets)
+			return b >= from && b < to
+		},
+	})
+}
+
+// bucketOf returns the bucket in [0, totalBuckets) for id.
+func bucketOf(id any, totalBuckets int) int {
+	return int(hashValue(id) % uint64(totalBuckets))
+}
+
+// VerbLock returns a copy of parent where the lock is unlocked when the
+// HTTP method stored as a string under verbKey in the evaluated
+// context is one of allowed, such as "GET" and "HEAD".
+//
+// Methods are compared case-insensitively, so "get" matches "GET" even
+// though HTTP methods are case-sensitive, since handlers storing the
+// method often normalize it differently. The lock is locked if the
+// value is missing or isn't a string, and when allowed is empty.
+func VerbLock(parent context.Context, lockKey any, verbKey any, allowed ...string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: verbKey,
+		Check: func(value any) bool {
+			return containsFold(value, allowed)
+		},
+	})
+}
+
+// IsZeroLock returns a copy of parent where the lock is unlocked when
+// the value stored under valueKey in the evaluated context is missing
+// or is the zero value for its type.
+//
+// Zero values are detected with [reflect.Value.IsZero]: "" for
+// strings, 0 for numbers, false for booleans, nil for pointers,
+// interfaces, maps, slices, channels and functions, and structs and
+// arrays whose every element is zero. Note that empty but non-nil maps
+// and slices are not zero.
+func IsZeroLock(parent context.Context, lockKey any, valueKey any) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: valueKey,
+		Check: func(value any) bool {
+			return value == nil || reflect.ValueOf(value).IsZero()
+		},
+	})
+}
+
+// BudgetLock returns a copy of parent where the lock is unlocked when
+// the rate limiter stored under budgetKey in the evaluated context
+// allows another event.
+//
+// The value must implement
+//
+//	Allow() bool
+//
+// which is the case for token buckets such as
+// golang.org/x/time/rate.Limiter. Allow is called, and a token may be
+// consumed, every time the lock is evaluated. The lock is locked if the
+// value is missing or doesn't implement the method.
+func BudgetLock(parent context.Context, lockKey any, budgetKey any) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: budgetKey,
+		Check: func(value any) bool {
+			budget, ok := value.(interface{ Allow() bool })
+			return ok && budget.Allow()
+		},
+	})
+}
+
+// PrefixLock returns a copy of parent where the lock is unlocked when
+// the string stored under valueKey in the evaluated context starts with
+// prefix, such as a request path under "/internal/".
+//
+// The lock is locked if the value is missing or isn't a string.
+func PrefixLock(parent context.Context, lockKey any, valueKey any, prefix string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: valueKey,
+		Check: func(value any) bool {
+			s, ok := value.(string)
+			return ok && strings.HasPrefix(s, prefix)
+		},
+	})
+}
+
+// SuffixLock works like [PrefixLock] but unlocks the lock when the
+// string ends with suffix.
+func SuffixLock(parent context.Context, lockKey any, valueKey any, suffix string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: valueKey,
+		Check: func(value any) bool {
+			s, ok := value.(string)
+			return ok && strings.HasSuffix(s, suffix)
+		},
+	})
+}
+
+// ValuePredicateLock returns a copy of parent where the lock is
+// unlocked when pred returns true for the value stored under valueKey
+// in the evaluated context.
+//
+// Unlike [FunctionLock], pred is passed the value directly rather than
+// the context. If there is no value for valueKey, pred is called with
+// nil.
+func ValuePredicateLock(parent context.Context, lockKey any, valueKey any, pred func(any) bool) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key:   valueKey,
+		Check: pred,
+	})
+}
+
+// ValidLock returns a copy of parent where the lock is unlocked when
+// validate returns nil for the value stored under valueKey in the
+// evaluated context.
+//
+// It works like [ValuePredicateLock], but the error returned by
+// validate is available from [UnlockedErr] and [ValueErr], so the
+// reason for rejecting a payload can be passed on. If there is no
+// value for valueKey, validate is called with nil. The lock is of
+// [KindFunction], since it's evaluated like an [ErrFunctionLock].
+func ValidLock(parent context.Context, lockKey any, valueKey any, validate func(any) error) context.Context {
+	return ErrFunctionLock(parent, lockKey, func(ctx context.Context) (bool, error) {
+		if err := validate(ctx.Value(valueKey)); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// CapabilityLock returns a copy of parent where the lock is unlocked
+// when the set of capabilities stored under capsKey in the evaluated
+// context contains required.
+//
+// The capabilities may be stored either as a map[string]struct{} or as
+// a []string. Capabilities are compared exactly. The lock is locked if
+// the value is missing, is of another type, or doesn't contain the
+// required capability.
+func CapabilityLock(parent context.Context, lockKey any, capsKey any, required string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: capsKey,
+		Check: func(value any) bool {
+			switch caps := value.(type) {
+			case map[string]struct{}:
+				_, ok := caps[required]
+				return ok
+			case []string:
+				for _, c := range caps {
+					if c == required {
+						return true
+					}
+				}
+				return false
+			default:
+				return false
+			}
+		},
+	})
+}
+
+// ValueEqualsLock returns a copy of parent where the lock is unlocked
+// when the value stored under checkKey in the evaluated context is
+// deeply equal to expected, according to [reflect.DeepEqual].
+//
+// This is meant for gating on unprotected context values such as a
+// tenant id or a feature flag. If there is no value for checkKey, the
+// lock is unlocked only if expected is nil.
+func ValueEqualsLock(parent context.Context, lockKey any, checkKey any, expected any) context.Context {
+	return withLock(parent, lockKey, equals{Key: checkKey, Expected: expected})
+}
+
+// ScopeLock returns a copy of parent where the lock is unlocked when
+// the scopes stored as a []string under scopesKey in the evaluated
+// context grant required.
+//
+// A scope grants required if it's equal to it, or if it ends with the
+// wildcard segment ":*" and required starts with the rest of the scope
+// including the colon, so "read:*" grants "read:users" and
+// "read:users:email" but not "read" or "write:users". The scope "*"
+// grants every scope. Wildcards elsewhere in a scope are compared as
+// is. The lock is locked if the scopes are missing or empty.
+func ScopeLock(parent context.Context, lockKey any, scopesKey any, required string) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: scopesKey,
+		Check: func(value any) bool {
+			scopes, _ := value.([]string)
+			for _, scope := range scopes {
+				if scopeGrants(scope, required) {
+					return true
+				}
+			}
+			return false
+		},
+	})
+}
+
+// scopeGrants returns true if scope grants required, see [ScopeLock].
+func scopeGrants(scope, required string) bool {
+	if scope == "*" || scope == required {
+		return true
+	}
+
+	prefix := strings.TrimSuffix(scope, "*")
+	return prefix != scope && strings.HasSuffix(prefix, ":") &&
+		len(required) > len(prefix) && strings.HasPrefix(required, prefix)
+}
+
+// BeforeLock returns a copy of parent where the lock is unlocked when
+// the [time.Time] stored under earlierKey in the evaluated context is
+// strictly before the time.Time stored under laterKey.
+//
+// The lock is locked if either value is missing or isn't a time.Time.
+func BeforeLock(parent context.Context, lockKey any, earlierKey, laterKey any) context.Context {
+	return withLock(parent, lockKey, before{EarlierKey: earlierKey, LaterKey: laterKey})
+}
+
+func (b before) unlocked(ctx context.Context) bool {
+	earlier, ok := ctx.Value(b.EarlierKey).(time.Time)
+	if !ok {
+		return false
+	}
+	later, ok := ctx.Value(b.LaterKey).(time.Time)
+	if !ok {
+		return false
+	}
+	return earlier.Before(later)
+}
+
+// EveryNLock returns a copy of parent where the lock is unlocked when
+// the counter stored under counterKey in the evaluated context is a
+// multiple of n.
+//
+// With a counter which is incremented for every request, this exposes
+// a value for every nth request, which can be used for cheap
+// deterministic sampling. The counter may be an int64 or an int. The
+// lock is locked if n is less than 1 or the counter is missing or of
+// another type.
+func EveryNLock(parent context.Context, lockKey any, counterKey any, n int64) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: counterKey,
+		Check: func(value any) bool {
+			if n < 1 {
+				return false
+			}
+
+			switch counter := value.(type) {
+			case int64:
+				return counter%n == 0
+			case int:
+				return int64(counter)%n == 0
+			default:
+				return false
+			}
+		},
+	})
+}
+
+// SDKFlagLock returns a copy of parent where the lock is unlocked when
+// the feature flag client stored under clientKey in the evaluated
+// context reports flag as enabled.
+//
+// The client must implement
+//
+//	BoolFlag(ctx context.Context, key string) bool
+//
+// which most feature flag SDKs can be adapted to with a small wrapper.
+// BoolFlag is called with the evaluated context every time the lock is
+// evaluated. The lock is locked if the client is missing or doesn't
+// implement the method.
+func SDKFlagLock(parent context.Context, lockKey any, clientKey any, flag string) context.Context {
+	return withLock(parent, lockKey, sdkFlag{ClientKey: clientKey, Flag: flag})
+}
+
+func (f sdkFlag) unlocked(ctx context.Context) bool {
+	client, ok := ctx.Value(f.ClientKey).(interface {
+		BoolFlag(ctx context.Context, key string) bool
+	})
+	return ok && client.BoolFlag(ctx, f.Flag)
+}
+
+// ErrorIsLock returns a copy of parent where the lock is unlocked when
+// the error stored under errKey in the evaluated context matches target
+// according to [errors.Is].
+//
+// This can be used to expose a remediation value only when a specific
+// error occurred upstream. The lock is locked if the value is missing
+// or isn't an error.
+func ErrorIsLock(parent context.Context, lockKey any, errKey any, target error) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: errKey,
+		Check: func(value any) bool {
+			err, ok := value.(error)
+			return ok && errors.Is(err, target)
+		},
+	})
+}
+
+// LenAtLeastLock returns a copy of parent where the lock is unlocked
+// when the length of the value stored under valueKey in the evaluated
+// context is at least min.
+//
+// The length is read with reflection and is supported for strings,
+// where it's the number of bytes, and for arrays, slices, maps and
+// channels. The lock is locked if the value is missing or of a type
+// without a length.
+func LenAtLeastLock(parent context.Context, lockKey any, valueKey any, min int) context.Context {
+	return withLock(parent, lockKey, condition{
+		Key: valueKey,
+		Check: func(value any) bool {
+			v := reflect.ValueOf(value)
+			switch v.Kind() {
+			case reflect.String, reflect.Array, reflect.Slice, reflect.Map, reflect.Chan:
+				return v.Len() >= min
+			default:
+				return false
+			}
+		},
+	})
+}
+
+// HealthyLock returns a copy of parent where the lock is unlocked while
+// the health checker stored under checkerKey in the evaluated context
+// reports that it's healthy.
+//
+// The checker must implement
+//
+//	Healthy(ctx context.Context) bool
+//
+// and is called with the context passed to [Unlocked] on every check,
+// so checkers which are expensive to run should cache their result.
+// The lock is locked if the checker is missing or doesn't implement the
+// method.
+func HealthyLock(parent context.Context, lockKey any, checkerKey any) context.Context {
+	return withLock(parent, lockKey, healthy{CheckerKey: checkerKey})
+}
+
+func (h healthy) unlocked(ctx context.Context) bool {
+	c, ok := ctx.Value(h.CheckerKey).(interface{ Healthy(context.Context) bool })
+	return ok && c.Healthy(ctx)
+}
+
+// A TrustRoot identifies a trusted call tree, see [TrustedLock].
+//
+// Roots are compared by identity and every root returned by
+// [NewTrustRoot] is distinct, so only code holding a root can mark a
+// context with it.
+type TrustRoot struct {
+	// the field makes the struct non-zero sized, so that pointers to
+	// different roots are never equal.
+	_ byte
+}
+
+// NewTrustRoot returns a new, unique [TrustRoot].
+func NewTrustRoot() *TrustRoot {
+	return &TrustRoot{}
+}
+
+// Mark returns a copy of parent which is marked as the root of the
+// trusted call tree identified by r, see [TrustedLock].
+func (r *TrustRoot) Mark(parent context.Context) context.Context {
+	return context.WithValue(parent, trustRootKey{root: r}, true)
+}
+
+// TrustedLock returns a copy of parent where the lock is unlocked only
+// when the evaluated context is derived from a context marked with
+// root using [TrustRoot.Mark].
+//
+// This makes values readable only within a trusted call tree. The
+// marker is checked on the context passed to [Unlocked], so a value
+// guarded by the lock can be added before the trust root is set, and
+// is locked when read from a context which isn't derived from one.
+// Contexts marked with another root don't unlock the lock, and neither
+// does a nil root.
+func TrustedLock(parent context.Context, lockKey any, root *TrustRoot) context.Context {
+	return withLock(parent, lockKey, trusted{Root: root})
+}
@@ -0,0 +1,728 @@
+package contextlock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sakjur/contextlock"
+)
+
+func TestETagLock(t *testing.T) {
+	type lock struct{}
+	type etag struct{}
+
+	tests := []struct {
+		name     string
+		parent   context.Context
+		unlocked bool
+	}{
+		{"match", context.WithValue(context.Background(), etag{}, `"v2"`), true},
+		{"mismatch", context.WithValue(context.Background(), etag{}, `"v1"`), false},
+		{"not a string", context.WithValue(context.Background(), etag{}, 2), false},
+		{"missing", context.Background(), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contextlock.ETagLock(tc.parent, lock{}, etag{}, `"v2"`)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestRangeLock(t *testing.T) {
+	type lock struct{}
+	type value struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"below", 9, false},
+		{"lower bound", 10, true},
+		{"inside", int64(15), true},
+		{"inside float", 15.5, true},
+		{"upper bound", uint8(20), true},
+		{"above", 20.0001, false},
+		{"not a number", "15", false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, value{}, tc.value)
+			}
+
+			ctx = contextlock.RangeLock(ctx, lock{}, value{}, 10, 20)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestHasDeadlineLock(t *testing.T) {
+	type lock struct{}
+
+	ctx := contextlock.HasDeadlineLock(context.Background(), lock{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	True(t, contextlock.Unlocked(deadlineCtx, lock{}))
+}
+
+func TestEnvLock(t *testing.T) {
+	type lock struct{}
+	type env struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"allowed", "staging", true},
+		{"allowed different case", "DEV", true},
+		{"disallowed", "prod", false},
+		{"not a string", 1, false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, env{}, tc.value)
+			}
+
+			ctx = contextlock.EnvLock(ctx, lock{}, env{}, "staging", "dev")
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+type challengeResult bool
+
+func (c challengeResult) Passed() bool {
+	return bool(c)
+}
+
+func TestChallengeLock(t *testing.T) {
+	type lock struct{}
+	type result struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"passed", challengeResult(true), true},
+		{"failed", challengeResult(false), false},
+		{"not a result", true, false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, result{}, tc.value)
+			}
+
+			ctx = contextlock.ChallengeLock(ctx, lock{}, result{})
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestMatchLock(t *testing.T) {
+	type lock struct{}
+	type email struct{}
+	type confirm struct{}
+
+	tests := []struct {
+		name     string
+		a, b     any
+		unlocked bool
+	}{
+		{"matching", "a@example.com", "a@example.com", true},
+		{"matching slices", []string{"a"}, []string{"a"}, true},
+		{"mismatching", "a@example.com", "b@example.com", false},
+		{"different types", 1, int64(1), false},
+		{"one missing", "a@example.com", nil, false},
+		{"both missing", nil, nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.a != nil {
+				ctx = context.WithValue(ctx, email{}, tc.a)
+			}
+			if tc.b != nil {
+				ctx = context.WithValue(ctx, confirm{}, tc.b)
+			}
+
+			ctx = contextlock.MatchLock(ctx, lock{}, email{}, confirm{})
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestBucketLock(t *testing.T) {
+	type lock struct{}
+	type tenant struct{}
+
+	// the buckets are part of the API and must not change.
+	buckets := map[string]int{}
+	for _, id := range []string{"acme", "globex", "initech", "umbrella", "hooli", "stark"} {
+		for b := 0; b < 4; b++ {
+			ctx := context.WithValue(context.Background(), tenant{}, id)
+			ctx = contextlock.BucketLock(ctx, lock{}, tenant{}, b, 4)
+			if contextlock.Unlocked(ctx, lock{}) {
+				_, seen := buckets[id]
+				False(t, seen)
+				buckets[id] = b
+			}
+		}
+	}
+	Equal(t, map[string]int{
+		"acme":     3,
+		"globex":   2,
+		"initech":  1,
+		"umbrella": 1,
+		"hooli":    2,
+		"stark":    2,
+	}, buckets)
+
+	t.Run("range", func(t *testing.T) {
+		for id, b := range buckets {
+			ctx := context.WithValue(context.Background(), tenant{}, id)
+			Equal(t, b < 2, contextlock.Unlocked(contextlock.BucketRangeLock(ctx, lock{}, tenant{}, 0, 2, 4), lock{}))
+			True(t, contextlock.Unlocked(contextlock.BucketRangeLock(ctx, lock{}, tenant{}, 0, 4, 4), lock{}))
+		}
+	})
+
+	t.Run("missing id", func(t *testing.T) {
+		ctx := contextlock.BucketRangeLock(context.Background(), lock{}, tenant{}, 0, 4, 4)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("no buckets", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), tenant{}, "acme")
+		ctx = contextlock.BucketLock(ctx, lock{}, tenant{}, 0, 0)
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestVerbLock(t *testing.T) {
+	type lock struct{}
+	type verb struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"allowed", "GET", true},
+		{"allowed lowercase", "head", true},
+		{"disallowed", "POST", false},
+		{"not a string", []byte("GET"), false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, verb{}, tc.value)
+			}
+
+			ctx = contextlock.VerbLock(ctx, lock{}, verb{}, "GET", "HEAD")
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestIsZeroLock(t *testing.T) {
+	type lock struct{}
+	type field struct{}
+	type profile struct {
+		Name string
+	}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"empty string", "", true},
+		{"zero int", 0, true},
+		{"zero struct", profile{}, true},
+		{"nil slice", []string(nil), true},
+		{"string", "Ada", false},
+		{"int", 1, false},
+		{"struct", profile{Name: "Ada"}, false},
+		{"empty slice", []string{}, false},
+		{"missing", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, field{}, tc.value)
+			}
+
+			ctx = contextlock.IsZeroLock(ctx, lock{}, field{})
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+type fakeBudget struct {
+	tokens int
+}
+
+func (b *fakeBudget) Allow() bool {
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func TestBudgetLock(t *testing.T) {
+	type lock struct{}
+	type budget struct{}
+
+	ctx := context.WithValue(context.Background(), budget{}, &fakeBudget{tokens: 2})
+	ctx = contextlock.BudgetLock(ctx, lock{}, budget{})
+
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	False(t, contextlock.Unlocked(ctx, lock{}))
+
+	t.Run("missing", func(t *testing.T) {
+		ctx := contextlock.BudgetLock(context.Background(), lock{}, budget{})
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("not a budget", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), budget{}, 2)
+		ctx = contextlock.BudgetLock(ctx, lock{}, budget{})
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestPrefixSuffixLock(t *testing.T) {
+	type lock struct{}
+	type path struct{}
+
+	tests := []struct {
+		name   string
+		value  any
+		prefix bool
+		suffix bool
+	}{
+		{"both", "/internal/debug.json", true, true},
+		{"prefix", "/internal/debug", true, false},
+		{"suffix", "/public/debug.json", false, true},
+		{"neither", "/public/index.html", false, false},
+		{"not a string", 42, false, false},
+		{"missing", nil, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, path{}, tc.value)
+			}
+
+			Equal(t, tc.prefix, contextlock.Unlocked(contextlock.PrefixLock(ctx, lock{}, path{}, "/internal/"), lock{}))
+			Equal(t, tc.suffix, contextlock.Unlocked(contextlock.SuffixLock(ctx, lock{}, path{}, ".json"), lock{}))
+		})
+	}
+}
+
+func TestValuePredicateLock(t *testing.T) {
+	type lock struct{}
+	type age struct{}
+
+	adult := func(value any) bool {
+		n, ok := value.(int)
+		return ok && n >= 18
+	}
+
+	ctx := context.WithValue(context.Background(), age{}, 21)
+	True(t, contextlock.Unlocked(contextlock.ValuePredicateLock(ctx, lock{}, age{}, adult), lock{}))
+
+	ctx = context.WithValue(context.Background(), age{}, 12)
+	False(t, contextlock.Unlocked(contextlock.ValuePredicateLock(ctx, lock{}, age{}, adult), lock{}))
+
+	// the predicate is called with nil for missing values.
+	var called bool
+	ctx = contextlock.ValuePredicateLock(context.Background(), lock{}, age{}, func(value any) bool {
+		called = true
+		return value == nil
+	})
+	True(t, contextlock.Unlocked(ctx, lock{}))
+	True(t, called)
+}
+
+func TestValidLock(t *testing.T) {
+	type lock struct{}
+	type payload struct{}
+
+	validate := func(value any) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("payload is %T, expected string", value)
+		}
+		if s == "" {
+			return errors.New("payload is empty")
+		}
+		return nil
+	}
+
+	ctx := context.WithValue(context.Background(), payload{}, "hello")
+	ctx = contextlock.ValidLock(ctx, lock{}, payload{}, validate)
+	unlocked, err := contextlock.UnlockedErr(ctx, lock{})
+	True(t, unlocked)
+	Nil(t, err)
+
+	ctx = context.WithValue(ctx, payload{}, "")
+	unlocked, err = contextlock.UnlockedErr(ctx, lock{})
+	False(t, unlocked)
+	Equal(t, "payload is empty", err.Error())
+
+	// validate is called with nil for missing values.
+	ctx = contextlock.ValidLock(context.Background(), lock{}, payload{}, validate)
+	unlocked, err = contextlock.UnlockedErr(ctx, lock{})
+	False(t, unlocked)
+	Equal(t, "payload is <nil>, expected string", err.Error())
+}
+
+func TestCapabilityLock(t *testing.T) {
+	type lock struct{}
+	type caps struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"map with capability", map[string]struct{}{"billing:read": {}, "users:read": {}}, true},
+		{"map without capability", map[string]struct{}{"users:read": {}}, false},
+		{"slice with capability", []string{"users:read", "billing:read"}, true},
+		{"slice without capability", []string{"users:read"}, false},
+		{"other type", map[string]bool{"billing:read": true}, false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, caps{}, tc.value)
+			}
+
+			ctx = contextlock.CapabilityLock(ctx, lock{}, caps{}, "billing:read")
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestBeforeLock(t *testing.T) {
+	type lock struct{}
+	type created struct{}
+	type updated struct{}
+
+	t0 := time.Date(2007, 8, 1, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		created, updated any
+		unlocked         bool
+	}{
+		{"ordered", t0, t0.Add(time.Second), true},
+		{"reversed", t0.Add(time.Second), t0, false},
+		{"equal", t0, t0, false},
+		{"not a time", "2007-08-01", t0, false},
+		{"earlier missing", nil, t0, false},
+		{"later missing", t0, nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.created != nil {
+				ctx = context.WithValue(ctx, created{}, tc.created)
+			}
+			if tc.updated != nil {
+				ctx = context.WithValue(ctx, updated{}, tc.updated)
+			}
+
+			ctx = contextlock.BeforeLock(ctx, lock{}, created{}, updated{})
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestEveryNLock(t *testing.T) {
+	type lock struct{}
+	type counter struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		n        int64
+		unlocked bool
+	}{
+		{"multiple", int64(30), 10, true},
+		{"zero", int64(0), 10, true},
+		{"not a multiple", int64(31), 10, false},
+		{"int", 20, 10, true},
+		{"n is zero", int64(30), 0, false},
+		{"n is negative", int64(30), -10, false},
+		{"not an int", 30.0, 10, false},
+		{"missing", nil, 10, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, counter{}, tc.value)
+			}
+
+			ctx = contextlock.EveryNLock(ctx, lock{}, counter{}, tc.n)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+type fakeFlagClient map[string]bool
+
+func (c fakeFlagClient) BoolFlag(ctx context.Context, key string) bool {
+	return c[key]
+}
+
+func TestSDKFlagLock(t *testing.T) {
+	type lock struct{}
+	type client struct{}
+
+	ctx := context.WithValue(context.Background(), client{}, fakeFlagClient{"new-ui": true, "beta": false})
+
+	True(t, contextlock.Unlocked(contextlock.SDKFlagLock(ctx, lock{}, client{}, "new-ui"), lock{}))
+	False(t, contextlock.Unlocked(contextlock.SDKFlagLock(ctx, lock{}, client{}, "beta"), lock{}))
+	False(t, contextlock.Unlocked(contextlock.SDKFlagLock(ctx, lock{}, client{}, "unknown"), lock{}))
+
+	t.Run("missing", func(t *testing.T) {
+		ctx := contextlock.SDKFlagLock(context.Background(), lock{}, client{}, "new-ui")
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+
+	t.Run("not a client", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), client{}, map[string]bool{"new-ui": true})
+		ctx = contextlock.SDKFlagLock(ctx, lock{}, client{}, "new-ui")
+		False(t, contextlock.Unlocked(ctx, lock{}))
+	})
+}
+
+func TestErrorIsLock(t *testing.T) {
+	type lock struct{}
+	type errKey struct{}
+
+	errQuota := errors.New("quota exceeded")
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"matching", errQuota, true},
+		{"wrapped", fmt.Errorf("upload: %w", errQuota), true},
+		{"non-matching", errors.New("quota exceeded"), false},
+		{"not an error", "quota exceeded", false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, errKey{}, tc.value)
+			}
+
+			ctx = contextlock.ErrorIsLock(ctx, lock{}, errKey{}, errQuota)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestLenAtLeastLock(t *testing.T) {
+	type lock struct{}
+	type items struct{}
+
+	tests := []struct {
+		name     string
+		value    any
+		unlocked bool
+	}{
+		{"short string", "ab", false},
+		{"string at boundary", "abc", true},
+		{"short slice", []int{1, 2}, false},
+		{"slice at boundary", []int{1, 2, 3}, true},
+		{"long slice", []int{1, 2, 3, 4}, true},
+		{"small map", map[string]int{"a": 1}, false},
+		{"map at boundary", map[string]int{"a": 1, "b": 2, "c": 3}, true},
+		{"no length", 3, false},
+		{"missing", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.value != nil {
+				ctx = context.WithValue(ctx, items{}, tc.value)
+			}
+
+			ctx = contextlock.LenAtLeastLock(ctx, lock{}, items{}, 3)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+type healthChecker bool
+
+func (h healthChecker) Healthy(ctx context.Context) bool {
+	return bool(h)
+}
+
+func TestHealthyLock(t *testing.T) {
+	type lock struct{}
+	type checker struct{}
+
+	ctx := contextlock.HealthyLock(context.Background(), lock{}, checker{})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, contextlock.KindValue, contextlock.LockKind(ctx, lock{}))
+
+	True(t, contextlock.Unlocked(context.WithValue(ctx, checker{}, healthChecker(true)), lock{}))
+	False(t, contextlock.Unlocked(context.WithValue(ctx, checker{}, healthChecker(false)), lock{}))
+	False(t, contextlock.Unlocked(context.WithValue(ctx, checker{}, "healthy"), lock{}))
+}
+
+func TestTrustedLock(t *testing.T) {
+	type lock struct{}
+	type secret struct{}
+
+	root := contextlock.NewTrustRoot()
+	ctx := contextlock.WithValue(context.Background(), lock{}, secret{}, "hunter2")
+	ctx = contextlock.TrustedLock(ctx, lock{}, root)
+
+	_, ok := contextlock.Value(ctx, secret{})
+	False(t, ok)
+
+	trusted := root.Mark(ctx)
+	v, ok := contextlock.Value(context.WithValue(trusted, "request", 1), secret{})
+	True(t, ok)
+	Equal(t, any("hunter2"), v)
+
+	// another root doesn't unlock the lock.
+	_, ok = contextlock.Value(contextlock.NewTrustRoot().Mark(ctx), secret{})
+	False(t, ok)
+
+	// a value stored under a look-alike key isn't a trust root.
+	type trustRootKey struct{}
+	_, ok = contextlock.Value(context.WithValue(ctx, trustRootKey{}, true), secret{})
+	False(t, ok)
+
+	// neither is a lock without a root.
+	ctx = contextlock.TrustedLock(ctx, lock{}, nil)
+	_, ok = contextlock.Value(root.Mark(ctx), secret{})
+	False(t, ok)
+}
+
+func TestScopeLock(t *testing.T) {
+	type lock struct{}
+	type scopes struct{}
+
+	tests := []struct {
+		name     string
+		scopes   any
+		required string
+		unlocked bool
+	}{
+		{"exact", []string{"write:users", "read:users"}, "read:users", true},
+		{"wildcard", []string{"read:*"}, "read:users", true},
+		{"nested wildcard", []string{"read:*"}, "read:users:email", true},
+		{"nested prefix wildcard", []string{"read:users:*"}, "read:users:email", true},
+		{"everything", []string{"*"}, "admin", true},
+		{"other scope", []string{"write:users"}, "read:users", false},
+		{"wildcard other prefix", []string{"write:*"}, "read:users", false},
+		{"wildcard without segment", []string{"read:*"}, "read:", false},
+		{"wildcard parent", []string{"read:*"}, "read", false},
+		{"partial segment", []string{"re*"}, "read:users", false},
+		{"empty", []string{}, "read:users", false},
+		{"missing", nil, "read:users", false},
+		{"wrong type", "read:users", "read:users", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), scopes{}, tc.scopes)
+			ctx = contextlock.ScopeLock(ctx, lock{}, scopes{}, tc.required)
+			Equal(t, tc.unlocked, contextlock.Unlocked(ctx, lock{}))
+		})
+	}
+}
+
+func TestValueEqualsLock(t *testing.T) {
+	type lock struct{}
+	type tenant struct{}
+
+	ctx := contextlock.ValueEqualsLock(context.Background(), lock{}, tenant{}, []string{"acme", "eu"})
+	False(t, contextlock.Unlocked(ctx, lock{}))
+	Equal(t, contextlock.KindValue, contextlock.LockKind(ctx, lock{}))
+
+	True(t, contextlock.Unlocked(context.WithValue(ctx, tenant{}, []string{"acme", "eu"}), lock{}))
+	False(t, contextlock.Unlocked(context.WithValue(ctx, tenant{}, []string{"acme", "us"}), lock{}))
+	False(t, contextlock.Unlocked(context.WithValue(ctx, tenant{}, "acme"), lock{}))
+}
+
+type panickingGrant struct{}
+
+func (panickingGrant) Valid(now time.Time) bool {
+	panic("invalid grant")
+}
+
+func TestValueLockPanic(t *testing.T) {
+	type lock struct{}
+	type grant struct{}
+
+	var observed []any
+	ctx := contextlock.WithPanicObserver(context.Background(), func(v any) {
+		observed = append(observed, v)
+	})
+	ctx = context.WithValue(ctx, grant{}, panickingGrant{})
+
+	predCtx := contextlock.ValuePredicateLock(ctx, lock{}, "value", func(any) bool {
+		panic("oops")
+	})
+	False(t, contextlock.Unlocked(predCtx, lock{}))
+	grantCtx := contextlock.GrantLock(ctx, lock{}, grant{})
+	False(t, contextlock.Unlocked(grantCtx, lock{}))
+	Equal(t, []any{"oops", "invalid grant"}, observed)
+
+	defer func() {
+		Equal(t, any("oops"), recover())
+	}()
+	contextlock.Unlocked(contextlock.WithStrictUnlockers(predCtx), lock{})
+	t.Fatal("expected panic")
+}